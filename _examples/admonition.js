@@ -0,0 +1,70 @@
+var bytes = require("go.bytes");
+var gparser = require("goldmark.parser");
+var gutil = require("goldmark.util");
+var gsegment = require("goldmark.text.segment");
+var gast = require("goldmark.ast");
+var grenderer = require("goldmark.renderer");
+var hrenderer = require("goldmark.renderer.html");
+
+var kindAdmonition = gast.newNodeKind("admonition");
+
+function isFence(line) {
+  return bytes.string(line).slice(0, 3) === ":::";
+}
+
+module.exports = function(m, opts) {
+  var admonitionBlockParser = gparser.newBlockParser({
+    triggers: ":",
+    open: function(self, parent, reader, pc) {
+      var ret = reader.peekLine(), line = ret[0], segment = ret[1];
+      if (!isFence(line)) {
+        return [null, gparser.noChildren];
+      }
+      var cls = bytes.string(line).slice(3).trim() || "admonition";
+      var node = gast.newBlockNode({
+        kind: kindAdmonition,
+        props: {
+          "class": cls
+        }
+      });
+      reader.advance(gsegment.len(segment) - 1);
+      return [node, gparser.hasChildren];
+    },
+    "continue": function(self, node, reader, pc) {
+      var ret = reader.peekLine(), line = ret[0], segment = ret[1];
+      if (isFence(line)) {
+        reader.advance(gsegment.len(segment) - 1);
+        return gparser.close;
+      }
+      return gparser.hasChildren | gparser["continue"];
+    },
+    close: function(self, node, reader, pc) {
+      // nothing to do
+    }
+  });
+
+  var prefix = opts.prefix || "";
+  var admonitionHTMLRenderer = hrenderer.newRenderer({
+    registerFuncs: function(self, reg) {
+      reg.register(kindAdmonition, function(w, source, n, entering) {
+        if (entering) {
+          w.writeString("<div class=\"" + prefix + n.prop("class") + "\">");
+        } else {
+          w.writeString("</div>");
+        }
+        return gast.walkContinue;
+      });
+    }
+  });
+
+  m.parser().addOptions(
+    gparser.withBlockParsers(
+      gutil.prioritized(admonitionBlockParser, 999)
+    )
+  );
+  m.renderer().addOptions(
+    grenderer.withNodeRenderers(
+      gutil.prioritized(admonitionHTMLRenderer, 999)
+    )
+  );
+};
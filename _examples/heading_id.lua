@@ -0,0 +1,42 @@
+local gbytes = require 'goldmark.bytes'
+local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+local gast = require 'goldmark.ast'
+local gmeta = require 'goldmark.meta'
+
+local kindheading = gast.kindHeading
+local walkcontinue = gast.walkContinue
+
+-- slugify converts a text into an id. This function is exported to Go.
+local function slugify(text)
+  local slug = string.lower(text):gsub("[^%w]+", "-"):gsub("^%-+", ""):gsub("%-+$", "")
+  return slug
+end
+
+return {
+  slugify = slugify,
+
+  extend = function(m, opts)
+    local headingIDTransformer = gparser.newASTTransformer({
+      transform = function(self, node, reader, pc)
+        local source = reader:source()
+        gast.walk(node, function(n, entering)
+          if entering and n:kind() == kindheading then
+            local text = gbytes.toString(n:text(source))
+            local id = slugify(text)
+            n:setAttributeString("id", gbytes.fromString(id))
+            -- collected headings are available in Go by dynamic.DocumentMeta
+            gmeta.append(pc, "headings", { id = id, level = n.level, text = text })
+          end
+          return walkcontinue, nil
+        end)
+      end
+    })
+
+    m:parser():addOptions(
+      gparser.withASTTransformers(
+        gutil.prioritized(headingIDTransformer, 999)
+      )
+    )
+  end
+}
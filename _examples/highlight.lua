@@ -0,0 +1,53 @@
+local gast = require 'goldmark.ast'
+local gparser = require 'goldmark.parser'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+local gutil = require 'goldmark.util'
+
+local kindHighlight = gast.newNodeKind("highlight")
+
+-- ==text== is rendered as <mark>text</mark>.
+return function(m, opts)
+  local char = opts.char or "="
+  local delimiterProcessor = gparser.newDelimiterProcessor({
+    isDelimiter = function(self, b)
+      return string.char(b) == char
+    end,
+    canOpenCloser = function(self, opener, closer)
+      return opener.char == closer.char
+    end,
+    onMatch = function(self, consumes)
+      return gast.newInlineNode({
+        kind = kindHighlight
+      })
+    end
+  })
+
+  local highlightInlineParser = gparser.newInlineParser({
+    triggers = char,
+    parse = function(self, parent, block, pc)
+      -- delimiters that have less than 2 characters are not highlights.
+      return gparser.parseDelimiter(block, pc, 2, delimiterProcessor)
+    end
+  })
+
+  local highlightHTMLRenderer = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(kindHighlight, function(w, source, n, entering)
+        w:writeString(entering and "<mark>" or "</mark>")
+        return gast.walkContinue, nil
+      end)
+    end
+  })
+
+  m:parser():addOptions(
+    gparser.withInlineParsers(
+      gutil.prioritized(highlightInlineParser, 500)
+    )
+  )
+  m:renderer():addOptions(
+    grenderer.withNodeRenderers(
+      gutil.prioritized(highlightHTMLRenderer, 500)
+    )
+  )
+end
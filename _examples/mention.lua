@@ -1,50 +1,60 @@
-local bytes = require 'go.bytes'
+local gbytes = require 'goldmark.bytes'
+local gregexp = require 'go.regexp'
 local gparser = require 'goldmark.parser'
 local gutil = require 'goldmark.util'
-local gtext = require 'goldmark.text'
-local gsegment = require 'goldmark.text.segment'
 local gast = require 'goldmark.ast'
 local grenderer = require 'goldmark.renderer'
 local hrenderer = require 'goldmark.renderer.html'
+local gdynamic = require 'goldmark.dynamic'
 
 local format = string.format
-local bstring, bsub = bytes.string, bytes.sub
-local isspace, prioritized = gutil.isSpace, gutil.prioritized
+local peekline = gbytes.peekLine
+local rfind = gregexp.find
+local prioritized = gutil.prioritized
 local walkcontinue = gast.walkContinue
 
 local kindMention = gast.newNodeKind("mention")
 
-return function(m, opts) 
+-- host applications can provide a 'mention.users' module that has a
+-- profileURL(name) function by dynamic.WithGoModule.
+local hasusers, users = pcall(require, "mention.users")
+
+return function(m, opts)
   local mentionInlineParser = gparser.newInlineParser({
     triggers = "@",
     parse = function(self, parent, block, pc)
-      local line, segment = block:peekLine()
-      local length = 0
-      for i = 1, #line do
-        if isspace(line[i]) or i == #line then
-          length = i - 1
-          break
-        end
-      end
-      block:advance(length)
-      if length ~= 0 then
-        return gast.newInlineNode({
-          kind = kindMention,
-          props = {
-            name = bstring(bsub(line, 1, length))
-          }
-        })
+      local line = peekline(block)
+      local _, stop, name = rfind(line, [[^@([\p{L}\p{N}_\-]+)]])
+      if not stop then
+        return nil
       end
-      return nil
+      block:advance(stop)
+      return gast.newInlineNode({
+        kind = kindMention,
+        props = {
+          name = name
+        }
+      })
     end
   })
-  
-  class = opts.class or "mention"
+
+  local class = opts.class or "mention"
   local mentionHTMLRenderer = hrenderer.newRenderer({
     registerFuncs = function(self, reg)
-      reg:register(kindMention,  function(w, source, n, entering) 
+      reg:register(kindMention,  function(w, source, n, entering)
         if entering then
-          w:writeString(format("<span class=\"%s\">@%s</span>", class, n:prop("name")))
+          local name = n:prop("name")
+          local url = hasusers and users.profileURL(name) or ""
+          -- a current user can be given by dynamic.WithDocumentVars.
+          local cls = class
+          if gdynamic.vars(n).user == name then
+            cls = cls .. " " .. class .. "-me"
+          end
+          if #url ~= 0 then
+            w:writeString(format("<a class=\"%s\" href=\"%s\">@%s</a>", cls, url, name))
+          else
+            w:writeString(format("<span class=\"%s\">@%s</span>", cls, name))
+          end
         end
         return walkcontinue, nil
       end)
@@ -62,4 +72,3 @@ return function(m, opts)
     )
   )
 end
-
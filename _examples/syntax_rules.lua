@@ -0,0 +1,60 @@
+local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+local grenderer = require 'goldmark.renderer'
+
+local prioritized = gutil.prioritized
+
+return function(m, opts)
+  local hashtag = gparser.inlinePattern({
+    triggers = "#",
+    pattern = [[#(?P<tag>[\p{L}\p{N}_]+)]],
+    kind = "hashtag",
+    html = [[<a class="hashtag" href="/tags/${tag}">#${tag}</a>]]
+  })
+
+  local details = gparser.fencedBlock({
+    triggers = "+",
+    open = [[\+\+\+\s*(?P<summary>.*?)\s*$]],
+    close = [[\+\+\+\s*$]],
+    kind = "details",
+    props = function(m)
+      if m.summary == "" then
+        return { summary = "Details" }
+      end
+      return { summary = m.summary }
+    end,
+    html = {
+      enter = "<details><summary>${summary}</summary>\n",
+      exit = "</details>\n"
+    }
+  })
+
+  local verbatim = gparser.fencedBlock({
+    triggers = "%",
+    open = [[%%%\s*$]],
+    close = [[%%%\s*$]],
+    kind = "verbatim",
+    raw = true,
+    html = {
+      enter = "<pre class=\"verbatim\">",
+      exit = "</pre>\n"
+    }
+  })
+
+  m:parser():addOptions(
+    gparser.withInlineParsers(
+      prioritized(hashtag, 999)
+    ),
+    gparser.withBlockParsers(
+      prioritized(details, 999),
+      prioritized(verbatim, 999)
+    )
+  )
+  m:renderer():addOptions(
+    grenderer.withNodeRenderers(
+      prioritized(hashtag:newRenderer(), 999),
+      prioritized(details:newRenderer(), 999),
+      prioritized(verbatim:newRenderer(), 999)
+    )
+  )
+end
@@ -0,0 +1,111 @@
+//go:build wasip1
+
+// Command mention is an example of goldmark-dynamic WebAssembly extensions.
+// This extension renders @name as a mention.
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o mention.wasm
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"unsafe"
+)
+
+func main() {}
+
+// buffers keeps memory that is passed to the host alive.
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport gd_alloc
+func gdAlloc(size uint32) uint32 {
+	buf := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport gd_free
+func gdFree(ptr, size uint32) {
+	delete(buffers, ptr)
+}
+
+func input(ptr, size uint32, v any) {
+	if err := json.Unmarshal(buffers[ptr][:size], v); err != nil {
+		panic(err)
+	}
+}
+
+func output(data []byte) uint64 {
+	ptr := gdAlloc(uint32(len(data)))
+	copy(buffers[ptr], data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func outputJSON(v any) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return output(data)
+}
+
+var class = "mention"
+
+//go:wasmexport gd_init
+func gdInit(ptr, size uint32) {
+	var options map[string]string
+	input(ptr, size, &options)
+	if v, ok := options["class"]; ok {
+		class = v
+	}
+}
+
+//go:wasmexport gd_manifest
+func gdManifest() uint64 {
+	return outputJSON(map[string]any{
+		"inlineParsers": []any{
+			map[string]any{"id": 1, "triggers": "@"},
+		},
+		"renderers": []any{
+			map[string]any{"id": 1, "kinds": []string{"mention"}},
+		},
+	})
+}
+
+var mentionPattern = regexp.MustCompile(`^@([\p{L}\p{N}_\-]+)`)
+
+//go:wasmexport gd_inline_parse
+func gdInlineParse(id, ptr, size uint32) uint64 {
+	var in struct {
+		Line string `json:"line"`
+	}
+	input(ptr, size, &in)
+	m := mentionPattern.FindStringSubmatch(in.Line)
+	if m == nil {
+		return 0
+	}
+	return outputJSON(map[string]any{
+		"kind":    "mention",
+		"consume": len(m[0]),
+		"props": map[string]any{
+			"name": m[1],
+		},
+	})
+}
+
+//go:wasmexport gd_render
+func gdRender(id, ptr, size uint32) uint64 {
+	var in struct {
+		Props    map[string]string `json:"props"`
+		Entering bool              `json:"entering"`
+	}
+	input(ptr, size, &in)
+	if !in.Entering {
+		return 0
+	}
+	return output([]byte(fmt.Sprintf(`<span class="%s">@%s</span>`,
+		html.EscapeString(class), html.EscapeString(in.Props["name"]))))
+}
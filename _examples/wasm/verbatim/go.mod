@@ -0,0 +1,3 @@
+module github.com/yuin/goldmark-dynamic/_examples/wasm/verbatim
+
+go 1.24
@@ -0,0 +1,124 @@
+//go:build wasip1
+
+// Command verbatim is an example of goldmark-dynamic WebAssembly extensions
+// that define raw blocks. This extension renders lines between %%% as they
+// are.
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o verbatim.wasm
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+	"unsafe"
+)
+
+func main() {}
+
+// buffers keeps memory that is passed to the host alive.
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport gd_alloc
+func gdAlloc(size uint32) uint32 {
+	buf := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport gd_free
+func gdFree(ptr, size uint32) {
+	delete(buffers, ptr)
+}
+
+func input(ptr, size uint32, v any) {
+	if err := json.Unmarshal(buffers[ptr][:size], v); err != nil {
+		panic(err)
+	}
+}
+
+func output(data []byte) uint64 {
+	ptr := gdAlloc(uint32(len(data)))
+	copy(buffers[ptr], data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+func outputJSON(v any) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return output(data)
+}
+
+//go:wasmexport gd_manifest
+func gdManifest() uint64 {
+	return outputJSON(map[string]any{
+		"blockParsers": []any{
+			map[string]any{"id": 1, "triggers": "%", "canInterruptParagraph": true},
+		},
+		"renderers": []any{
+			map[string]any{"id": 1, "kinds": []string{"verbatim"}},
+		},
+	})
+}
+
+var fencePattern = regexp.MustCompile(`^%%%\s*$`)
+
+type blockInput struct {
+	Line  string            `json:"line"`
+	Props map[string]string `json:"props"`
+}
+
+// trimNewline removes a trailing newline("\n" or "\r\n") of the line.
+func trimNewline(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
+
+//go:wasmexport gd_block_open
+func gdBlockOpen(id, ptr, size uint32) uint64 {
+	var in blockInput
+	input(ptr, size, &in)
+	if !fencePattern.MatchString(in.Line) {
+		return 0
+	}
+	return outputJSON(map[string]any{
+		"kind":     "verbatim",
+		"consume":  len(trimNewline(in.Line)),
+		"children": false,
+		"props":    map[string]any{"text": ""},
+	})
+}
+
+//go:wasmexport gd_block_continue
+func gdBlockContinue(id, ptr, size uint32) uint64 {
+	var in blockInput
+	input(ptr, size, &in)
+	if fencePattern.MatchString(in.Line) {
+		return outputJSON(map[string]any{
+			"close":   true,
+			"consume": len(trimNewline(in.Line)),
+		})
+	}
+	// lines of raw blocks are added by goldmark-dynamic, props hold a text
+	// to render.
+	return outputJSON(map[string]any{
+		"children": false,
+		"props":    map[string]any{"text": in.Props["text"] + in.Line},
+	})
+}
+
+//go:wasmexport gd_render
+func gdRender(id, ptr, size uint32) uint64 {
+	var in struct {
+		Props    map[string]string `json:"props"`
+		Entering bool              `json:"entering"`
+	}
+	input(ptr, size, &in)
+	if !in.Entering {
+		return output([]byte("</pre>\n"))
+	}
+	return output([]byte(`<pre class="verbatim">` + html.EscapeString(in.Props["text"])))
+}
@@ -0,0 +1,112 @@
+local gast = require 'goldmark.ast'
+local gparser = require 'goldmark.parser'
+local gcontext = require 'goldmark.parser.context'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+local gutil = require 'goldmark.util'
+local gbytes = require 'goldmark.bytes'
+local gmeta = require 'goldmark.meta'
+
+local format = string.format
+local tostr = gbytes.toString
+
+local kindWikiLink = gast.newNodeKind("WikiLink")
+
+-- a list of undefined labels in a document. This is stored in the
+-- 'missingWikiLinks' metadata.
+local missingKey = gcontext.newKey("wiki_link.missing")
+
+-- [[Label]] and [[Label|text]] are rendered as links to destinations of link
+-- reference definitions([label]: url). Labels that are not defined are
+-- resolved by opts.base if it is given.
+return function(m, opts)
+  local base = opts.base
+
+  local wikiLinkInlineParser = gparser.newInlineParser({
+    triggers = "[",
+    parse = function(self, parent, block, pc)
+      local mark = block:mark()
+      if not block:consume([[\[\[]]) then
+        return nil
+      end
+      local content = block:readUntil("]")
+      if not content or #content == 0 or block:peek(2) ~= "]]" then
+        block:reset(mark)
+        return nil
+      end
+      block:advance(2)
+      local label, text = content:match("^([^|]+)|(.+)$")
+      label = label or content
+      text = text or content
+
+      local ref = gcontext.reference(pc, label)
+      local destination = ref and ref.destination
+      if not destination then
+        local missing = gcontext.get(pc, missingKey)
+        if not missing then
+          missing = {}
+          gcontext.set(pc, missingKey, missing)
+        end
+        table.insert(missing, label)
+        if base then
+          destination = base .. label:gsub(" ", "_")
+        end
+      end
+      return gast.newInlineNode({
+        kind = kindWikiLink,
+        props = {
+          text = text,
+          destination = destination or "",
+          title = ref and ref.title or "",
+        }
+      })
+    end
+  })
+
+  local missingTransformer = gparser.newASTTransformer({
+    transform = function(self, node, reader, pc)
+      local missing = gcontext.get(pc, missingKey)
+      if missing then
+        gmeta.set(pc, "missingWikiLinks", missing)
+      end
+    end
+  })
+
+  local wikiLinkHTMLRenderer = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(kindWikiLink, function(w, source, n, entering)
+        if not entering then
+          return gast.walkContinue, nil
+        end
+        local text = tostr(gutil.escapeHTML(n:prop("text")))
+        local destination = n:prop("destination")
+        if #destination == 0 then
+          w:writeString(format('<span class="wiki-link-missing">%s</span>', text))
+          return gast.walkContinue, nil
+        end
+        local title = n:prop("title")
+        if #title ~= 0 then
+          title = format(' title="%s"', tostr(gutil.escapeHTML(title)))
+        end
+        w:writeString(format('<a class="wiki-link" href="%s"%s>%s</a>',
+          tostr(gutil.escapeHTML(gutil.urlEscape(destination, true))), title, text))
+        return gast.walkContinue, nil
+      end)
+    end
+  })
+
+  m:parser():addOptions(
+    gparser.withInlineParsers(
+      -- must be tried before the link parser(priority=200).
+      gutil.prioritized(wikiLinkInlineParser, 199)
+    ),
+    gparser.withASTTransformers(
+      gutil.prioritized(missingTransformer, 999)
+    )
+  )
+  m:renderer():addOptions(
+    grenderer.withNodeRenderers(
+      gutil.prioritized(wikiLinkHTMLRenderer, 999)
+    )
+  )
+end
@@ -0,0 +1,42 @@
+local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+local gast = require 'goldmark.ast'
+local gbytes = require 'goldmark.bytes'
+local gmeta = require 'goldmark.meta'
+
+local kindheading = gast.kindHeading
+local kindparagraph = gast.kindParagraph
+local kindtextblock = gast.kindTextBlock
+local walkcontinue = gast.walkContinue
+
+-- word_count publishes 'wordCount' and 'readingTime'(minutes) as metadata.
+-- 'wordsPerMinute' can be given by front matter(goldmark-meta with
+-- meta.WithStoresInDocument()).
+return function(m, opts)
+  local wordCountTransformer = gparser.newASTTransformer({
+    transform = function(self, node, reader, pc)
+      local source = reader:source()
+      local count = 0
+      gast.walk(node, function(n, entering)
+        local kind = n:kind()
+        if entering and (kind == kindheading or kind == kindparagraph or kind == kindtextblock) then
+          for _ in gbytes.toString(n:text(source)):gmatch("%S+") do
+            count = count + 1
+          end
+          return gast.walkSkipChildren, nil
+        end
+        return walkcontinue, nil
+      end)
+      local wpm = gmeta.get(pc, "wordsPerMinute") or (opts and opts.wordsPerMinute) or 200
+      gmeta.set(pc, "wordCount", count)
+      gmeta.set(pc, "readingTime", math.ceil(count / wpm))
+    end
+  })
+
+  m:parser():addOptions(
+    gparser.withASTTransformers(
+      -- runs after goldmark-meta stores front matter(priority 0)
+      gutil.prioritized(wordCountTransformer, 999)
+    )
+  )
+end
@@ -4,253 +4,254 @@ import (
 	"fmt"
 
 	"github.com/yuin/goldmark/ast"
-	lua "github.com/yuin/gopher-lua"
-	luar "layeh.com/gopher-luar"
 )
 
-func exportGoldmarkAST(l *lua.LState, opts options) {
-	l.PreloadModule("goldmark.ast", func(l *lua.LState) int {
-		mod := l.NewTable()
-		for _, def := range []struct {
-			name  string
-			value any
-		}{
-			{
-				name:  "newNodeKind",
-				value: ast.NewNodeKind,
-			},
-			{
-				name:  "walkContinue",
-				value: ast.WalkContinue,
-			},
-			{
-				name:  "walkSkipChildren",
-				value: ast.WalkSkipChildren,
-			},
-			{
-				name:  "walkStop",
-				value: ast.WalkStop,
-			},
-			{
-				name:  "walk",
-				value: ast.Walk,
-			},
-			{
-				name:  "isParagraph",
-				value: ast.IsParagraph,
-			},
-			{
-				name:  "mergeOrAppendTextSegment",
-				value: ast.MergeOrAppendTextSegment,
-			},
-			{
-				name:  "mergeOrReplaceTextSegment",
-				value: ast.MergeOrReplaceTextSegment,
-			},
-			{
-				name:  "kindAutoLink",
-				value: ast.KindAutoLink,
-			},
-			{
-				name:  "kindBlockquote",
-				value: ast.KindBlockquote,
-			},
-			{
-				name:  "kindCodeBlock",
-				value: ast.KindCodeBlock,
-			},
-			{
-				name:  "kindCodeSpan",
-				value: ast.KindCodeSpan,
-			},
-			{
-				name:  "kindDocument",
-				value: ast.KindDocument,
-			},
-			{
-				name:  "kindEmphasis",
-				value: ast.KindEmphasis,
-			},
-			{
-				name:  "kindFencedCodeBlock",
-				value: ast.KindFencedCodeBlock,
-			},
-			{
-				name:  "kindHTMLBlock",
-				value: ast.KindHTMLBlock,
-			},
-			{
-				name:  "kindHeading",
-				value: ast.KindHeading,
-			},
-			{
-				name:  "kindImage",
-				value: ast.KindImage,
-			},
-			{
-				name:  "kindLink",
-				value: ast.KindLink,
-			},
-			{
-				name:  "kindList",
-				value: ast.KindList,
-			},
-			{
-				name:  "kindListItem",
-				value: ast.KindListItem,
-			},
-			{
-				name:  "kindParagraph",
-				value: ast.KindParagraph,
-			},
-			{
-				name:  "kindRawHTML",
-				value: ast.KindRawHTML,
-			},
-			{
-				name:  "kindString",
-				value: ast.KindString,
-			},
-			{
-				name:  "kindText",
-				value: ast.KindText,
-			},
-			{
-				name:  "kindTextBlock",
-				value: ast.KindTextBlock,
-			},
-			{
-				name:  "kindThematicBreak",
-				value: ast.KindThematicBreak,
-			},
-		} {
-			mod.RawSetString(def.name, luar.New(l, def.value))
-		}
-
-		mod.RawSetString("newInlineNode", l.NewFunction(func(l *lua.LState) int {
-			value := newDynamicInlineNode(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, value)
-			l.Push(ud)
-			return 1
-		}))
-
-		mod.RawSetString("newBlockNode", l.NewFunction(func(l *lua.LState) int {
-			value := newDynamicBlockNode(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, value)
-			l.Push(ud)
-			return 1
-		}))
-
-		l.Push(mod)
-		return 1
-	})
+func goldmarkASTMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name:  "newNodeKind",
+			value: ast.NewNodeKind,
+		},
+		{
+			name:  "walkContinue",
+			value: ast.WalkContinue,
+		},
+		{
+			name:  "walkSkipChildren",
+			value: ast.WalkSkipChildren,
+		},
+		{
+			name:  "walkStop",
+			value: ast.WalkStop,
+		},
+		{
+			name:  "walk",
+			value: ast.Walk,
+		},
+		{
+			name:  "isParagraph",
+			value: ast.IsParagraph,
+		},
+		{
+			name:  "mergeOrAppendTextSegment",
+			value: ast.MergeOrAppendTextSegment,
+		},
+		{
+			name:  "mergeOrReplaceTextSegment",
+			value: ast.MergeOrReplaceTextSegment,
+		},
+		{
+			name:  "kindAutoLink",
+			value: ast.KindAutoLink,
+		},
+		{
+			name:  "kindBlockquote",
+			value: ast.KindBlockquote,
+		},
+		{
+			name:  "kindCodeBlock",
+			value: ast.KindCodeBlock,
+		},
+		{
+			name:  "kindCodeSpan",
+			value: ast.KindCodeSpan,
+		},
+		{
+			name:  "kindDocument",
+			value: ast.KindDocument,
+		},
+		{
+			name:  "kindEmphasis",
+			value: ast.KindEmphasis,
+		},
+		{
+			name:  "kindFencedCodeBlock",
+			value: ast.KindFencedCodeBlock,
+		},
+		{
+			name:  "kindHTMLBlock",
+			value: ast.KindHTMLBlock,
+		},
+		{
+			name:  "kindHeading",
+			value: ast.KindHeading,
+		},
+		{
+			name:  "kindImage",
+			value: ast.KindImage,
+		},
+		{
+			name:  "kindLink",
+			value: ast.KindLink,
+		},
+		{
+			name:  "kindList",
+			value: ast.KindList,
+		},
+		{
+			name:  "kindListItem",
+			value: ast.KindListItem,
+		},
+		{
+			name:  "kindParagraph",
+			value: ast.KindParagraph,
+		},
+		{
+			name:  "kindRawHTML",
+			value: ast.KindRawHTML,
+		},
+		{
+			name:  "kindString",
+			value: ast.KindString,
+		},
+		{
+			name:  "kindText",
+			value: ast.KindText,
+		},
+		{
+			name:  "kindTextBlock",
+			value: ast.KindTextBlock,
+		},
+		{
+			name:  "kindThematicBreak",
+			value: ast.KindThematicBreak,
+		},
+	}
 }
 
-var _ ast.Node = (*dynamicInlineNode)(nil)
+var goldmarkASTConstructors = []moduleConstructor{
+	{
+		name:   "newInlineNode",
+		object: "InlineNode",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicInlineNode(obj, onError)
+		},
+	},
+	{
+		name:   "newBlockNode",
+		object: "BlockNode",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicBlockNode(obj, onError)
+		},
+	},
+}
 
-type dynamicInlineNode struct {
-	ast.BaseInline
-	l       *lua.LState
-	props   *lua.LTable
+// dynamicNode is a common part of dynamic nodes.
+type dynamicNode struct {
+	nodePosition
 	onError func(error)
 
 	kind  ast.NodeKind
-	isRaw lua.LValue
-	p     lua.LValue
+	isRaw scriptFunc
+	raw   bool
+	p     nodeProps
+
+	// counters of IsRaw and Dump. These are set by parsers of extensions
+	// that create the node when metrics are enabled.
+	isRawCounter, dumpCounter *hookCounter
 }
 
-func newDynamicInlineNode(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicInlineNode {
-	pt := newPropTable(l, "InlineNode", props, onError)
+// setCounters sets counters of hooks of the node.
+func (n *dynamicNode) setCounters(isRaw, dump *hookCounter) {
+	n.isRawCounter = isRaw
+	n.dumpCounter = dump
+}
 
-	return &dynamicInlineNode{
-		l:       l,
-		props:   props,
+func newDynamicNode(obj scriptObject, onError func(error)) dynamicNode {
+	n := dynamicNode{
 		onError: onError,
 
-		kind:  ast.NodeKind(pt.Int("kind")),
-		isRaw: pt.Get("isRaw", lua.LTFunction, lua.LTNil),
-		p:     pt.Get("props", lua.LTTable, lua.LTNil),
+		kind: ast.NodeKind(obj.Int("kind")),
+		p:    obj.Props("props"),
+	}
+	switch v := obj.Value("isRaw").(type) {
+	case nil:
+	case bool:
+		n.raw = v
+	default:
+		n.isRaw = obj.Func("isRaw", false)
 	}
+	return n
 }
 
-func (n *dynamicInlineNode) Dump(source []byte, level int) {
+func (n *dynamicNode) dump(node ast.Node, source []byte, level int) {
+	defer n.dumpCounter.observe(n.dumpCounter.start())
 	p := map[string]string{}
-	if n.p != lua.LNil {
-		n.p.(*lua.LTable).ForEach(func(key, value lua.LValue) {
-			p[key.String()] = value.String()
-		})
+	for key, value := range n.p.toMap() {
+		p[key] = fmt.Sprint(value)
 	}
-	ast.DumpHelper(n, source, level, p, nil)
+	ast.DumpHelper(node, source, level, p, nil)
 }
 
-func (n *dynamicInlineNode) Kind() ast.NodeKind {
+func (n *dynamicNode) Kind() ast.NodeKind {
 	return n.kind
 }
 
-func (n *dynamicInlineNode) IsRaw() bool {
-	if n.isRaw == lua.LNil {
-		return false
+func (n *dynamicNode) IsRaw() bool {
+	if n.isRaw == nil {
+		return n.raw
 	}
-	if err := n.l.CallByParam(lua.P{
-		Fn:      n.isRaw.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}); err != nil {
+	defer n.isRawCounter.observe(n.isRawCounter.start())
+	ret, err := n.isRaw.call(1)
+	if err != nil {
 		n.onError(err)
-	}
-	ret := n.l.Get(-1)
-	n.l.Pop(1)
-
-	if _, err := mustLValue(ret, lua.LTBool); err != nil {
-		n.onError(fmt.Errorf("InlineNode:isRaw returns an invalid value: %w", err))
 		return false
 	}
+	v, ok := ret[0].(bool)
+	if !ok {
+		n.onError(fmt.Errorf("isRaw returns an invalid value: must be a boolean"))
+	}
+	return v
+}
+
+func (n *dynamicNode) Prop(name string) any {
+	return n.p.get(name)
+}
 
-	return bool(ret.(lua.LBool))
+func (n *dynamicNode) Props() map[string]any {
+	return n.p.toMap()
 }
 
-func (n *dynamicInlineNode) Prop(name string) any {
-	if n.p == lua.LNil {
-		return nil
+var _ PositionedNode = (*dynamicInlineNode)(nil)
+
+type dynamicInlineNode struct {
+	ast.BaseInline
+	dynamicNode
+}
+
+func newDynamicInlineNode(obj scriptObject, onError func(error)) *dynamicInlineNode {
+	return &dynamicInlineNode{
+		dynamicNode: newDynamicNode(obj, onError),
 	}
-	return n.l.GetField(n.p, name)
 }
 
-var _ ast.Node = (*dynamicBlockNode)(nil)
+func (n *dynamicInlineNode) Dump(source []byte, level int) {
+	n.dump(n, source, level)
+}
 
-type dynamicBlockNode struct {
-	ast.BaseBlock
-	l       *lua.LState
-	props   *lua.LTable
-	onError func(error)
+func (n *dynamicInlineNode) Kind() ast.NodeKind {
+	return n.kind
+}
 
-	kind  ast.NodeKind
-	isRaw lua.LValue
-	p     lua.LValue
+func (n *dynamicInlineNode) IsRaw() bool {
+	return n.dynamicNode.IsRaw()
 }
 
-func newDynamicBlockNode(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicBlockNode {
-	pt := newPropTable(l, "BlockNode", props, onError)
+var _ PositionedNode = (*dynamicBlockNode)(nil)
 
-	return &dynamicBlockNode{
-		l:       l,
-		props:   props,
-		onError: onError,
+type dynamicBlockNode struct {
+	ast.BaseBlock
+	dynamicNode
+}
 
-		kind:  ast.NodeKind(pt.Int("kind")),
-		isRaw: pt.Get("isRaw", lua.LTFunction, lua.LTNil),
-		p:     pt.Get("props", lua.LTTable, lua.LTNil),
+func newDynamicBlockNode(obj scriptObject, onError func(error)) *dynamicBlockNode {
+	return &dynamicBlockNode{
+		dynamicNode: newDynamicNode(obj, onError),
 	}
 }
 
 func (n *dynamicBlockNode) Dump(source []byte, level int) {
-	p := map[string]string{}
-	if n.p != lua.LNil {
-		n.p.(*lua.LTable).ForEach(func(key, value lua.LValue) {
-			p[key.String()] = value.String()
-		})
-	}
-	ast.DumpHelper(n, source, level, p, nil)
+	n.dump(n, source, level)
 }
 
 func (n *dynamicBlockNode) Kind() ast.NodeKind {
@@ -258,29 +259,5 @@ func (n *dynamicBlockNode) Kind() ast.NodeKind {
 }
 
 func (n *dynamicBlockNode) IsRaw() bool {
-	if n.isRaw == lua.LNil {
-		return false
-	}
-	if err := n.l.CallByParam(lua.P{
-		Fn:      n.isRaw.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}); err != nil {
-		n.onError(err)
-	}
-	ret := n.l.Get(-1)
-	n.l.Pop(1)
-	if _, err := mustLValue(ret, lua.LTBool); err != nil {
-		n.onError(fmt.Errorf("InlineNode:isRaw returns an invalid value: %w", err))
-		return false
-	}
-
-	return bool(ret.(lua.LBool))
-}
-
-func (n *dynamicBlockNode) Prop(name string) any {
-	if n.p == lua.LNil {
-		return nil
-	}
-	return n.l.GetField(n.p, name)
+	return n.dynamicNode.IsRaw()
 }
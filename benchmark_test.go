@@ -0,0 +1,863 @@
+package dynamic_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/yuin/goldmark-dynamic"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+func newBenchmarkMarkdown(b *testing.B, extensions ...Extension) (goldmark.Markdown, func()) {
+	ext, cleanup := New(WithExtensions(extensions))
+	return goldmark.New(goldmark.WithExtensions(ext)), cleanup
+}
+
+func benchmarkConvert(b *testing.B, markdown goldmark.Markdown, source []byte) {
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := markdown.Convert(source, &buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// mentionsSource is a document that has thousands of triggers of the
+// mention extension.
+var mentionsSource = []byte(strings.Repeat("@yuin hello @someone, mail to a@example.com\n\n", 1000))
+
+// admonitionsSource is a document that has thousands of lines in
+// admonition blocks.
+var admonitionsSource = []byte(strings.Repeat("::: note\naaa\nbbb *ccc*\n:::\n\n", 1000))
+
+func BenchmarkLuaInlineParser(b *testing.B) {
+	markdown, cleanup := newBenchmarkMarkdown(b, Extension{
+		File:    "_examples/mention.lua",
+		Options: map[string]string{},
+	})
+	defer cleanup()
+	benchmarkConvert(b, markdown, mentionsSource)
+}
+
+func BenchmarkLuaBlockParser(b *testing.B) {
+	markdown, cleanup := newBenchmarkMarkdown(b, Extension{
+		File:    "_examples/admonition.lua",
+		Options: map[string]string{},
+	})
+	defer cleanup()
+	benchmarkConvert(b, markdown, admonitionsSource)
+}
+
+// exampleBenchmark is a benchmark of scripts in _examples and a hand-written
+// Go equivalent of them.
+type exampleBenchmark struct {
+	name    string
+	source  []byte
+	scripts []Extension
+	goExt   goldmark.Extender
+}
+
+func exampleBenchmarks() []exampleBenchmark {
+	return []exampleBenchmark{
+		{
+			name:   "mention",
+			source: mentionsSource,
+			scripts: []Extension{
+				{File: "_examples/mention.lua", Options: map[string]string{}},
+				{File: "mention.wasm", Options: map[string]string{}},
+			},
+			goExt: &goMention{},
+		},
+		{
+			name:   "admonition",
+			source: admonitionsSource,
+			scripts: []Extension{
+				{File: "_examples/admonition.lua", Options: map[string]string{}},
+				{File: "_examples/admonition.js", Options: map[string]string{}},
+				{File: "_examples/admonition.star", Options: map[string]string{}},
+			},
+			goExt: &goAdmonition{},
+		},
+		{
+			name:   "heading_id",
+			source: []byte(strings.Repeat("# Hello, World!\n\n## Section 1\n\naaa\n\n", 500)),
+			scripts: []Extension{
+				{File: "_examples/heading_id.lua"},
+			},
+			goExt: &goHeadingID{},
+		},
+		{
+			name: "open_in_new_window",
+			source: []byte(strings.Repeat(
+				"[a](/index.html) [b](http://external.example.com) [c](http://self.example.com/c)\n\n", 1000)),
+			scripts: []Extension{
+				{File: "_examples/open_in_new_window.lua", Options: map[string]string{
+					"base": "http://self.example.com",
+				}},
+			},
+			goExt: &goOpenInNewWindow{base: []byte("http://self.example.com")},
+		},
+		{
+			name:   "word_count",
+			source: []byte(strings.Repeat("# Title\n\naaa bbb ccc ddd\n\n- item1 item2\n- item3\n\n", 500)),
+			scripts: []Extension{
+				{File: "_examples/word_count.lua"},
+			},
+			goExt: &goWordCount{},
+		},
+		{
+			name: "syntax_rules",
+			source: []byte(strings.Repeat("aaa #goldmark bbb\n\n+++ Click <here>\n*ccc* #tag\n+++\n\n"+
+				"+++\nddd\n+++\n\n%%%\n<b>raw</b>\n  *text*\n%%%\n\n", 300)),
+			scripts: []Extension{
+				{File: "_examples/syntax_rules.lua"},
+			},
+			goExt: newGoSyntaxRules(),
+		},
+		{
+			name: "rules.yaml",
+			source: []byte(strings.Repeat("aaa :smile: bbb\n\n::: warning\n*ccc*\n:::\n\n:::\nddd\n:::\n\n"+
+				"[a](/index.html) [b](http://external.example.com) [c](http://self.example.com/c)\n\n", 300)),
+			scripts: []Extension{
+				{File: "_examples/rules.yaml"},
+			},
+			goExt: newGoYAMLRules(),
+		},
+		{
+			name:   "rules.json",
+			source: []byte(strings.Repeat("aaa ~~bbb~~ ccc ~ ddd\n\n", 1000)),
+			scripts: []Extension{
+				{File: "_examples/rules.json"},
+			},
+			goExt: newGoJSONRules(),
+		},
+		{
+			name:   "highlight",
+			source: []byte(strings.Repeat("aaa ==bbb== ccc =ddd= ==*eee*==\n\n", 1000)),
+			scripts: []Extension{
+				{File: "_examples/highlight.lua", Options: map[string]string{}},
+			},
+			goExt: &goHighlight{},
+		},
+		{
+			name: "wiki_link",
+			source: []byte(strings.Repeat("[[Home]] [[Getting Started|start]] [[Missing Page]] [link][Home]\n\n", 1000) +
+				"[home]: /home \"Home page\"\n[getting started]: /start\n"),
+			scripts: []Extension{
+				{File: "_examples/wiki_link.lua", Options: map[string]string{"base": "/wiki/"}},
+			},
+			goExt: &goWikiLink{base: "/wiki/"},
+		},
+	}
+}
+
+// newExampleMarkdown returns a goldmark.Markdown extended by the script.
+// WebAssembly modules are built into a temporary directory.
+func newExampleMarkdown(tb testing.TB, script Extension) (goldmark.Markdown, func()) {
+	var fsys fs.StatFS = os.DirFS(".").(fs.StatFS)
+	if strings.HasSuffix(script.File, ".wasm") {
+		dir := tb.TempDir()
+		buildWasmExample(tb, dir, strings.TrimSuffix(script.File, ".wasm"))
+		fsys = os.DirFS(dir).(fs.StatFS)
+	}
+	ext, cleanup := New(WithFS(fsys), WithExtensions([]Extension{script}))
+	return goldmark.New(goldmark.WithExtensions(ext)), cleanup
+}
+
+func scriptName(script Extension) string {
+	return strings.TrimPrefix(script.File[strings.LastIndex(script.File, "."):], ".")
+}
+
+// BenchmarkExamples compares scripts in _examples with Go equivalents.
+//
+//	go test -run '^$' -bench Examples -benchmem
+func BenchmarkExamples(b *testing.B) {
+	for _, c := range exampleBenchmarks() {
+		c := c
+		for _, script := range c.scripts {
+			script := script
+			b.Run(c.name+"/"+scriptName(script), func(b *testing.B) {
+				markdown, cleanup := newExampleMarkdown(b, script)
+				defer cleanup()
+				benchmarkConvert(b, markdown, c.source)
+			})
+		}
+		b.Run(c.name+"/go", func(b *testing.B) {
+			benchmarkConvert(b, goldmark.New(goldmark.WithExtensions(c.goExt)), c.source)
+		})
+	}
+}
+
+// TestGoEquivalents ensures Go equivalents in benchmarks render same outputs
+// as scripts.
+func TestGoEquivalents(t *testing.T) {
+	for _, c := range exampleBenchmarks() {
+		var expected bytes.Buffer
+		if err := goldmark.New(goldmark.WithExtensions(c.goExt)).Convert(c.source, &expected); err != nil {
+			t.Fatal(err)
+		}
+		for _, script := range c.scripts {
+			script := script
+			t.Run(c.name+"/"+scriptName(script), func(t *testing.T) {
+				markdown, cleanup := newExampleMarkdown(t, script)
+				defer cleanup()
+				var actual bytes.Buffer
+				if err := markdown.Convert(c.source, &actual); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(actual.Bytes(), expected.Bytes()) {
+					t.Errorf("%s renders a different output from the Go equivalent:\n%s",
+						script.File, firstDifference(expected.Bytes(), actual.Bytes()))
+				}
+			})
+		}
+	}
+}
+
+func firstDifference(expected, actual []byte) string {
+	el := strings.Split(string(expected), "\n")
+	al := strings.Split(string(actual), "\n")
+	for i := 0; i < len(el) && i < len(al); i++ {
+		if el[i] != al[i] {
+			return fmt.Sprintf("line %d:\n  expected: %s\n  actual:   %s", i+1, el[i], al[i])
+		}
+	}
+	return fmt.Sprintf("expected %d lines, but got %d lines", len(el), len(al))
+}
+
+// goMention is a Go equivalent of _examples/mention.lua.
+type goMention struct{}
+
+var kindGoMention = ast.NewNodeKind("GoMention")
+
+type goMentionNode struct {
+	ast.BaseInline
+	name string
+}
+
+func (n *goMentionNode) Kind() ast.NodeKind {
+	return kindGoMention
+}
+
+func (n *goMentionNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"name": n.name}, nil)
+}
+
+var goMentionPattern = regexp.MustCompile(`^@([\p{L}\p{N}_\-]+)`)
+
+func (e *goMention) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (e *goMention) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	m := goMentionPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return nil
+	}
+	block.Advance(m[1])
+	return &goMentionNode{name: string(line[m[2]:m[3]])}
+}
+
+func (e *goMention) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGoMention, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			name := n.(*goMentionNode).name
+			class := "mention"
+			if DocumentVars(n)["user"] == name {
+				class += " mention-me"
+			}
+			_, _ = fmt.Fprintf(w, `<span class="%s">@%s</span>`, class, name)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goMention) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(e, 999)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 999)))
+}
+
+// goAdmonition is a Go equivalent of _examples/admonition.lua.
+type goAdmonition struct{}
+
+var kindGoAdmonition = ast.NewNodeKind("GoAdmonition")
+
+type goAdmonitionNode struct {
+	ast.BaseBlock
+	class []byte
+}
+
+func (n *goAdmonitionNode) Kind() ast.NodeKind {
+	return kindGoAdmonition
+}
+
+func (n *goAdmonitionNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"class": string(n.class)}, nil)
+}
+
+var goAdmonitionFence = []byte(":::")
+
+func (e *goAdmonition) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (e *goAdmonition) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	if !bytes.HasPrefix(line, goAdmonitionFence) {
+		return nil, parser.NoChildren
+	}
+	class := bytes.TrimSpace(line[3:])
+	if len(class) == 0 {
+		class = []byte("admonition")
+	}
+	reader.Advance(segment.Len() - 1)
+	return &goAdmonitionNode{class: class}, parser.HasChildren
+}
+
+func (e *goAdmonition) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if bytes.HasPrefix(line, goAdmonitionFence) {
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+	return parser.HasChildren | parser.Continue
+}
+
+func (e *goAdmonition) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+}
+
+func (e *goAdmonition) CanInterruptParagraph() bool {
+	return false
+}
+
+func (e *goAdmonition) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func (e *goAdmonition) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGoAdmonition, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = fmt.Fprintf(w, `<div class="%s">`, n.(*goAdmonitionNode).class)
+		} else {
+			_, _ = w.WriteString("</div>")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goAdmonition) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(e, 999)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 999)))
+}
+
+// goHeadingID is a Go equivalent of _examples/heading_id.lua.
+type goHeadingID struct{}
+
+var goHeadingsKey = parser.NewContextKey()
+
+var goSlugPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func (e *goHeadingID) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			text := string(n.Text(source))
+			id := strings.Trim(goSlugPattern.ReplaceAllString(strings.ToLower(text), "-"), "-")
+			n.SetAttributeString("id", []byte(id))
+			headings, _ := pc.Get(goHeadingsKey).([]any)
+			pc.Set(goHeadingsKey, append(headings, map[string]any{
+				"id": id, "level": heading.Level, "text": text,
+			}))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goHeadingID) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 999)))
+}
+
+// goOpenInNewWindow is a Go equivalent of _examples/open_in_new_window.lua.
+type goOpenInNewWindow struct {
+	base []byte
+}
+
+func (e *goOpenInNewWindow) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering {
+			dest := link.Destination
+			if !(bytes.HasPrefix(dest, []byte(".")) || bytes.HasPrefix(dest, []byte("/")) ||
+				bytes.HasPrefix(dest, e.base)) {
+				n.SetAttribute([]byte("target"), []byte("_blank"))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goOpenInNewWindow) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 999)))
+}
+
+// goWordCount is a Go equivalent of _examples/word_count.lua.
+type goWordCount struct{}
+
+var goWordCountKey = parser.NewContextKey()
+
+func (e *goWordCount) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	count := 0
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n.Kind() {
+		case ast.KindHeading, ast.KindParagraph, ast.KindTextBlock:
+			if entering {
+				count += len(strings.Fields(string(n.Text(source))))
+				return ast.WalkSkipChildren, nil
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	pc.Set(goWordCountKey, count)
+}
+
+func (e *goWordCount) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 999)))
+}
+
+// goPattern is a common part of nodes created by goInlinePattern and
+// goFencedBlock.
+type goPattern struct {
+	kind     ast.NodeKind
+	captures map[string]string
+}
+
+func (n *goPattern) Kind() ast.NodeKind {
+	return n.kind
+}
+
+func (n *goPattern) pattern() *goPattern {
+	return n
+}
+
+type goPatternInlineNode struct {
+	ast.BaseInline
+	goPattern
+}
+
+func (n *goPatternInlineNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, n.captures, nil)
+}
+
+type goPatternBlockNode struct {
+	ast.BaseBlock
+	goPattern
+	raw bool
+}
+
+func (n *goPatternBlockNode) IsRaw() bool {
+	return n.raw
+}
+
+func (n *goPatternBlockNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, n.captures, nil)
+}
+
+func goCaptures(re *regexp.Regexp, line []byte, loc []int, defaults map[string]string) map[string]string {
+	captures := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if len(name) != 0 && loc[i*2] >= 0 {
+			captures[name] = string(line[loc[i*2]:loc[i*2+1]])
+		}
+	}
+	for key, value := range defaults {
+		if captures[key] == "" {
+			captures[key] = value
+		}
+	}
+	return captures
+}
+
+// goExpand is a Go equivalent of html templates of syntax rules.
+func goExpand(template string, n ast.Node) string {
+	captures := n.(interface{ pattern() *goPattern }).pattern().captures
+	return os.Expand(template, func(key string) string {
+		return string(util.EscapeHTML([]byte(captures[key])))
+	})
+}
+
+// goInlinePattern is a Go equivalent of gparser.inlinePattern and inline
+// rules.
+type goInlinePattern struct {
+	trigger byte
+	pattern *regexp.Regexp
+	kind    ast.NodeKind
+	html    string
+}
+
+func (e *goInlinePattern) Trigger() []byte {
+	return []byte{e.trigger}
+}
+
+func (e *goInlinePattern) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	loc := e.pattern.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil
+	}
+	block.Advance(loc[1])
+	return &goPatternInlineNode{
+		goPattern: goPattern{kind: e.kind, captures: goCaptures(e.pattern, line, loc, nil)},
+	}
+}
+
+func (e *goInlinePattern) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(e.kind, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString(goExpand(e.html, n))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// goFencedBlock is a Go equivalent of gparser.fencedBlock and block rules.
+type goFencedBlock struct {
+	trigger  byte
+	open     *regexp.Regexp
+	close    *regexp.Regexp
+	raw      bool
+	kind     ast.NodeKind
+	defaults map[string]string
+	enter    string
+	exit     string
+}
+
+func (e *goFencedBlock) Trigger() []byte {
+	return []byte{e.trigger}
+}
+
+func goNewlineLength(line []byte) int {
+	return util.TrimRightLength(line, []byte("\r\n"))
+}
+
+func (e *goFencedBlock) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	loc := e.open.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil, parser.NoChildren
+	}
+	node := &goPatternBlockNode{
+		goPattern: goPattern{kind: e.kind, captures: goCaptures(e.open, line, loc, e.defaults)},
+		raw:       e.raw,
+	}
+	reader.Advance(segment.Len() - goNewlineLength(line))
+	if e.raw {
+		return node, parser.NoChildren
+	}
+	return node, parser.HasChildren
+}
+
+func (e *goFencedBlock) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if e.close.Match(line) {
+		reader.Advance(segment.Len() - goNewlineLength(line) + segment.Padding)
+		return parser.Close
+	}
+	if e.raw {
+		node.Lines().Append(segment)
+		reader.AdvanceAndSetPadding(segment.Len()-goNewlineLength(line), segment.Padding)
+		return parser.Continue | parser.NoChildren
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (e *goFencedBlock) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+}
+
+func (e *goFencedBlock) CanInterruptParagraph() bool {
+	return true
+}
+
+func (e *goFencedBlock) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func (e *goFencedBlock) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(e.kind, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			_, _ = w.WriteString(goExpand(e.exit, n))
+			return ast.WalkContinue, nil
+		}
+		_, _ = w.WriteString(goExpand(e.enter, n))
+		if e.raw {
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// goSyntaxRules is a Go equivalent of _examples/syntax_rules.lua and
+// _examples/rules.yaml and _examples/rules.json.
+type goSyntaxRules struct {
+	inlines      []*goInlinePattern
+	blocks       []*goFencedBlock
+	transformers []parser.ASTTransformer
+}
+
+func (e *goSyntaxRules) Extend(m goldmark.Markdown) {
+	for _, p := range e.inlines {
+		m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(p, 999)))
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(p, 999)))
+	}
+	for _, p := range e.blocks {
+		m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(p, 999)))
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(p, 999)))
+	}
+	for _, t := range e.transformers {
+		m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(t, 999)))
+	}
+}
+
+func newGoSyntaxRules() *goSyntaxRules {
+	return &goSyntaxRules{
+		inlines: []*goInlinePattern{{
+			trigger: '#',
+			pattern: regexp.MustCompile(`^#(?P<tag>[\p{L}\p{N}_]+)`),
+			kind:    ast.NewNodeKind("GoHashtag"),
+			html:    `<a class="hashtag" href="/tags/${tag}">#${tag}</a>`,
+		}},
+		blocks: []*goFencedBlock{
+			{
+				trigger:  '+',
+				open:     regexp.MustCompile(`^\+\+\+\s*(?P<summary>.*?)\s*$`),
+				close:    regexp.MustCompile(`^\+\+\+\s*$`),
+				kind:     ast.NewNodeKind("GoDetails"),
+				defaults: map[string]string{"summary": "Details"},
+				enter:    "<details><summary>${summary}</summary>\n",
+				exit:     "</details>\n",
+			},
+			{
+				trigger: '%',
+				open:    regexp.MustCompile(`^%%%\s*$`),
+				close:   regexp.MustCompile(`^%%%\s*$`),
+				raw:     true,
+				kind:    ast.NewNodeKind("GoVerbatim"),
+				enter:   `<pre class="verbatim">`,
+				exit:    "</pre>\n",
+			},
+		},
+	}
+}
+
+var goExternalLinkPattern = regexp.MustCompile(`^(\.|/|https?://self\.example\.com)`)
+
+// goExternalLinks is a Go equivalent of the attribute rule in
+// _examples/rules.yaml.
+type goExternalLinks struct{}
+
+func (t *goExternalLinks) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering && !goExternalLinkPattern.Match(link.Destination) {
+			n.SetAttributeString("rel", []byte("noopener"))
+			n.SetAttributeString("target", []byte("_blank"))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func newGoYAMLRules() *goSyntaxRules {
+	return &goSyntaxRules{
+		inlines: []*goInlinePattern{{
+			trigger: ':',
+			pattern: regexp.MustCompile(`^:smile:`),
+			kind:    ast.NewNodeKind("GoEmoji"),
+			html:    "😄",
+		}},
+		blocks: []*goFencedBlock{{
+			trigger:  ':',
+			open:     regexp.MustCompile(`^:::\s*(?P<type>\w*)\s*$`),
+			close:    regexp.MustCompile(`^:::\s*$`),
+			kind:     ast.NewNodeKind("GoContainer"),
+			defaults: map[string]string{"type": "note"},
+			enter:    "<div class=\"container-${type}\">\n",
+			exit:     "</div>\n",
+		}},
+		transformers: []parser.ASTTransformer{&goExternalLinks{}},
+	}
+}
+
+func newGoJSONRules() *goSyntaxRules {
+	return &goSyntaxRules{
+		inlines: []*goInlinePattern{{
+			trigger: '~',
+			pattern: regexp.MustCompile(`^~~(?P<text>[^~]+)~~`),
+			kind:    ast.NewNodeKind("GoStrike"),
+			html:    "<del>${text}</del>",
+		}},
+	}
+}
+
+// goHighlight is a Go equivalent of _examples/highlight.lua.
+type goHighlight struct{}
+
+var kindGoHighlight = ast.NewNodeKind("GoHighlight")
+
+type goHighlightNode struct {
+	ast.BaseInline
+}
+
+func (n *goHighlightNode) Kind() ast.NodeKind {
+	return kindGoHighlight
+}
+
+func (n *goHighlightNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+func (e *goHighlight) IsDelimiter(b byte) bool {
+	return b == '='
+}
+
+func (e *goHighlight) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (e *goHighlight) OnMatch(consumes int) ast.Node {
+	return &goHighlightNode{}
+}
+
+func (e *goHighlight) Trigger() []byte {
+	return []byte{'='}
+}
+
+func (e *goHighlight) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, 2, e)
+	if node == nil {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func (e *goHighlight) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGoHighlight, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("<mark>")
+		} else {
+			_, _ = w.WriteString("</mark>")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goHighlight) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(e, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 500)))
+}
+
+// goWikiLink is a Go equivalent of _examples/wiki_link.lua.
+type goWikiLink struct {
+	base string
+}
+
+var kindGoWikiLink = ast.NewNodeKind("GoWikiLink")
+
+var goWikiLinkMissingKey = parser.NewContextKey()
+
+type goWikiLinkNode struct {
+	ast.BaseInline
+	text        string
+	destination string
+	title       string
+}
+
+func (n *goWikiLinkNode) Kind() ast.NodeKind {
+	return kindGoWikiLink
+}
+
+func (n *goWikiLinkNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"text": n.text, "destination": n.destination, "title": n.title,
+	}, nil)
+}
+
+func (e *goWikiLink) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (e *goWikiLink) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	i := bytes.IndexByte(line[2:], ']')
+	if i <= 0 || !bytes.HasPrefix(line[2+i:], []byte("]]")) {
+		return nil
+	}
+	content := string(line[2 : 2+i])
+	block.Advance(2 + i + 2)
+	label, text := content, content
+	if l, t, ok := strings.Cut(content, "|"); ok && len(l) != 0 && len(t) != 0 {
+		label, text = l, t
+	}
+	node := &goWikiLinkNode{text: text}
+	if ref, ok := pc.Reference(util.ToLinkReference([]byte(label))); ok {
+		node.destination = string(ref.Destination())
+		node.title = string(ref.Title())
+	} else {
+		missing, _ := pc.Get(goWikiLinkMissingKey).([]string)
+		pc.Set(goWikiLinkMissingKey, append(missing, label))
+		if len(e.base) != 0 {
+			node.destination = e.base + strings.ReplaceAll(label, " ", "_")
+		}
+	}
+	return node
+}
+
+func (e *goWikiLink) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGoWikiLink, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		node := n.(*goWikiLinkNode)
+		text := util.EscapeHTML([]byte(node.text))
+		if len(node.destination) == 0 {
+			_, _ = fmt.Fprintf(w, `<span class="wiki-link-missing">%s</span>`, text)
+			return ast.WalkContinue, nil
+		}
+		title := ""
+		if len(node.title) != 0 {
+			title = fmt.Sprintf(` title="%s"`, util.EscapeHTML([]byte(node.title)))
+		}
+		_, _ = fmt.Fprintf(w, `<a class="wiki-link" href="%s"%s>%s</a>`,
+			util.EscapeHTML(util.URLEscape([]byte(node.destination), true)), title, text)
+		return ast.WalkContinue, nil
+	})
+}
+
+func (e *goWikiLink) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(e, 199)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 999)))
+}
@@ -0,0 +1,151 @@
+package dynamic
+
+import (
+	"sort"
+
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// contextKey is a key of a value stored in a parser.Context by extensions.
+// Keys are distinguished by identities, not by names, so extensions can not
+// overwrite values of other extensions.
+type contextKey struct {
+	name string
+	key  parser.ContextKey
+}
+
+// String implements fmt.Stringer.
+func (k *contextKey) String() string {
+	return k.name
+}
+
+func newContextKey(name string) *contextKey {
+	return &contextKey{name: name, key: parser.NewContextKey()}
+}
+
+// referenceToMap converts a reference into a map that has 'label',
+// 'destination' and 'title'.
+func referenceToMap(ref parser.Reference) map[string]any {
+	return map[string]any{
+		"label":       string(ref.Label()),
+		"destination": string(ref.Destination()),
+		"title":       string(ref.Title()),
+	}
+}
+
+// contextReference returns a reference that has the label. The label is
+// normalized like link reference definitions.
+func contextReference(pc parser.Context, label string) map[string]any {
+	ref, ok := pc.Reference(util.ToLinkReference([]byte(label)))
+	if !ok {
+		return nil
+	}
+	return referenceToMap(ref)
+}
+
+// contextReferences returns all references sorted by labels.
+func contextReferences(pc parser.Context) []any {
+	refs := pc.References()
+	sort.Slice(refs, func(i, j int) bool {
+		return string(refs[i].Label()) < string(refs[j].Label())
+	})
+	ret := make([]any, 0, len(refs))
+	for _, ref := range refs {
+		ret = append(ret, referenceToMap(ref))
+	}
+	return ret
+}
+
+// contextAddReference adds a reference like a link reference definition.
+// A reference that has the same label as an existing reference is ignored.
+func contextAddReference(pc parser.Context, label, destination, title string) {
+	pc.AddReference(parser.NewReference([]byte(label), []byte(destination), []byte(title)))
+}
+
+func goldmarkParserContextMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name:  "reference",
+			value: contextReference,
+		},
+		{
+			name:  "references",
+			value: contextReferences,
+		},
+		{
+			name:  "addReference",
+			value: contextAddReference,
+		},
+		{
+			name:  "newKey",
+			value: newContextKey,
+		},
+		{
+			name: "get",
+			value: func(pc parser.Context, key *contextKey) any {
+				return pc.Get(key.key)
+			},
+		},
+		{
+			name: "set",
+			value: func(pc parser.Context, key *contextKey, value any) {
+				pc.Set(key.key, value)
+			},
+		},
+		{
+			name: "blockOffset",
+			value: func(pc parser.Context) int {
+				return pc.BlockOffset()
+			},
+		},
+		{
+			name: "blockIndent",
+			value: func(pc parser.Context) int {
+				return pc.BlockIndent()
+			},
+		},
+	}
+}
+
+// exportGoldmarkParserContext overrides members that return references as
+// Lua tables. Values are stored as Lua values as is, so tables stored in a
+// context can be modified.
+func exportGoldmarkParserContext(r *luaRuntime, l *lua.LState, mod *lua.LTable) {
+	checkContext := func(l *lua.LState) parser.Context {
+		pc, ok := l.CheckUserData(1).Value.(parser.Context)
+		if !ok {
+			l.ArgError(1, "parser.Context expected")
+		}
+		return pc
+	}
+	checkKey := func(l *lua.LState) *contextKey {
+		key, ok := l.CheckUserData(2).Value.(*contextKey)
+		if !ok {
+			l.ArgError(2, "key expected")
+		}
+		return key
+	}
+	mod.RawSetString("reference", l.NewFunction(func(l *lua.LState) int {
+		ref := contextReference(checkContext(l), l.CheckString(2))
+		if ref == nil {
+			l.Push(lua.LNil)
+		} else {
+			l.Push(goToLua(l, ref))
+		}
+		return 1
+	}))
+	mod.RawSetString("references", l.NewFunction(func(l *lua.LState) int {
+		l.Push(goToLua(l, contextReferences(checkContext(l))))
+		return 1
+	}))
+	mod.RawSetString("get", l.NewFunction(func(l *lua.LState) int {
+		l.Push(goToLua(l, checkContext(l).Get(checkKey(l).key)))
+		return 1
+	}))
+	mod.RawSetString("set", l.NewFunction(func(l *lua.LState) int {
+		checkContext(l).Set(checkKey(l).key, l.Get(3))
+		return 0
+	}))
+}
@@ -2,22 +2,34 @@
 package dynamic
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"os"
-	"strings"
 
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
 	lua "github.com/yuin/gopher-lua"
-	luar "layeh.com/gopher-luar"
 )
 
 // Extension is a dynamic extension file for goldmark-dynamic.
+// File is a script or a declarative rule file. A runtime that loads the
+// file is selected by the file extension: Lua(.lua), JavaScript(.js),
+// Starlark(.star), WebAssembly(.wasm) or declarative rules written in
+// YAML(.yaml, .yml) or JSON(.json).
+// Options are not used by declarative rule files.
+// Name is used to enable or disable the extension per document. Name
+// defaults to a base name of the file without an extension.
+// If Priority is not 0, Priority overrides priorities of parsers,
+// transformers and renderers registered by the extension.
 type Extension struct {
-	File    string
-	Options any
+	File     string
+	Options  any
+	Name     string
+	Priority int
 }
 
 // Option is an option for the goldmark-dynamic extension.
@@ -46,6 +58,40 @@ func WithOnError(f func(error)) Option {
 	}
 }
 
+// WithRuntimes is an option that adds runtimes.
+// Runtimes added by this option take precedence over builtin runtimes.
+func WithRuntimes(v ...RuntimeFactory) Option {
+	return func(e *dynamic) {
+		e.factories = append(append([]RuntimeFactory{}, v...), e.factories...)
+	}
+}
+
+// WithModule is an option that adds a Lua module. The loader is called when
+// Lua extensions require the module.
+func WithModule(name string, loader func(*lua.LState) int) Option {
+	return func(e *dynamic) {
+		e.luaModules[name] = loader
+	}
+}
+
+// WithGoModule is an option that adds a module that consists of Go values.
+// Values are exported to all script runtimes in the same manner as goldmark
+// functionalities, so host applications can provide domain functions to
+// extensions.
+func WithGoModule(name string, values map[string]any) Option {
+	return func(e *dynamic) {
+		e.goModules[name] = values
+	}
+}
+
+// WithOnConflict is an option that sets a function that is called for
+// each [Conflict] after extensions are loaded.
+func WithOnConflict(f func(Conflict)) Option {
+	return func(e *dynamic) {
+		e.onConflict = f
+	}
+}
+
 type options interface {
 	OnError() func(error)
 }
@@ -54,23 +100,61 @@ type dynamic struct {
 	fs         fs.StatFS
 	extensions []Extension
 	onError    func(error)
-	states     []*lua.LState
+	factories  []RuntimeFactory
+	runtimes   []Runtime
+	goModules  map[string]map[string]any
+	luaModules map[string]lua.LGFunction
+	exports    map[string]Function
+
+	frontMatter   func(parser.Context) map[string]any
+	registrations []Registration
+	onConflict    func(Conflict)
+	metrics       *Metrics
+	tracer        Tracer
+	logger        *slog.Logger
+	printOutput   io.Writer
+	luaDebugger   *LuaDebugger
+	luaCoverage   *LuaCoverage
+}
+
+// Extender is a goldmark.Extender that can call functions exported by
+// extensions.
+type Extender interface {
+	goldmark.Extender
+
+	// Call calls a function exported by extensions and returns results.
+	// Functions are available after a goldmark.Markdown is extended.
+	// If extensions export functions that have the same name, a function
+	// exported by the last loaded extension is called.
+	Call(name string, args ...any) ([]any, error)
+
+	// Registrations returns parsers, transformers and renderers registered
+	// by extensions.
+	Registrations() []Registration
+
+	// Conflicts returns registrations of different extensions that share
+	// trigger characters or node kinds.
+	Conflicts() []Conflict
 }
 
 // New creates a new goldmark-dynamic extension.
-func New(opts ...Option) (goldmark.Extender, func()) {
+func New(opts ...Option) (Extender, func()) {
 	e := &dynamic{
 		fs: os.DirFS(".").(fs.StatFS),
 		onError: func(err error) {
 			panic(err)
 		},
+		goModules:  map[string]map[string]any{},
+		luaModules: map[string]lua.LGFunction{},
+		exports:    map[string]Function{},
+		factories:  []RuntimeFactory{LuaRuntime, JavaScriptRuntime, StarlarkRuntime, WasmRuntime, RuleRuntime},
 	}
 	for _, opt := range opts {
 		opt(e)
 	}
 	return e, func() {
-		for _, l := range e.states {
-			l.Close()
+		for _, r := range e.runtimes {
+			r.Close()
 		}
 	}
 }
@@ -79,203 +163,111 @@ func (e *dynamic) OnError() func(error) {
 	return e.onError
 }
 
-func exportGoldmark(l *lua.LState, opts options) {
-	l.PreloadModule("goldmark", func(l *lua.LState) int {
-		mod := l.NewTable()
-		for _, def := range []struct {
-			name  string
-			value any
-		}{
-			{
-				name:  "withExtensions",
-				value: goldmark.WithExtensions,
-			},
-			{
-				name:  "withParser",
-				value: goldmark.WithParser,
-			},
-			{
-				name:  "withParserOptions",
-				value: goldmark.WithParserOptions,
-			},
-			{
-				name:  "withRenderer",
-				value: goldmark.WithRenderer,
-			},
-			{
-				name:  "withRendererOptions",
-				value: goldmark.WithRendererOptions,
-			},
-		} {
-			mod.RawSetString(def.name, luar.New(l, def.value))
-		}
-		l.Push(mod)
-		return 1
-	})
+func (e *dynamic) Call(name string, args ...any) ([]any, error) {
+	fn, ok := e.exports[name]
+	if !ok {
+		return nil, fmt.Errorf("function '%s' is not exported by extensions", name)
+	}
+	return fn(args...)
 }
 
-func (e *dynamic) Extend(m goldmark.Markdown) {
-	l := lua.NewState()
-	e.states = append(e.states, l)
-	exportGoBytes(l, e)
-	exportGoldmark(l, e)
-	exportGoldmarkUtil(l, e)
-	exportGoldmarkText(l, e)
-	exportGoldmarkAST(l, e)
-	exportGoldmarkParser(l, e)
-	exportGoldmarkRenderer(l, e)
-	exportGoldmarkRendererHTML(l, e)
+func (e *dynamic) Registrations() []Registration {
+	return append([]Registration{}, e.registrations...)
+}
 
-	findFile := func(l *lua.LState, name, pname string) (string, string) {
-		name = strings.Replace(name, ".", string(os.PathSeparator), -1)
-		lv := l.GetField(l.GetField(l.Get(lua.EnvironIndex), "package"), pname)
-		path, ok := lv.(lua.LString)
-		if !ok {
-			l.RaiseError("package.%s must be a string", pname)
-		}
-		messages := []string{}
-		for _, pattern := range strings.Split(string(path), ";") {
-			luapath := strings.Replace(pattern, "?", name, -1)
-			_, err := e.fs.Stat(luapath)
-			if err == nil {
-				return luapath, ""
-			}
-			messages = append(messages, err.Error())
-		}
-		return "", strings.Join(messages, "\n\t")
-	}
+func (e *dynamic) Conflicts() []Conflict {
+	return findConflicts(e.registrations)
+}
 
-	fsLoader := func(l *lua.LState) int {
-		name := l.CheckString(1)
-		path, msg := findFile(l, name, "path")
-		if len(path) == 0 {
-			l.Push(lua.LString(msg))
-			return 1
-		}
-		fn, err1 := loadLuaFileFS(l, e.fs, path)
-		if err1 != nil {
-			l.RaiseError(err1.Error())
-		}
-		l.Push(fn)
-		return 1
+func goldmarkMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name:  "withExtensions",
+			value: goldmark.WithExtensions,
+		},
+		{
+			name:  "withParser",
+			value: goldmark.WithParser,
+		},
+		{
+			name:  "withParserOptions",
+			value: goldmark.WithParserOptions,
+		},
+		{
+			name:  "withRenderer",
+			value: goldmark.WithRenderer,
+		},
+		{
+			name:  "withRendererOptions",
+			value: goldmark.WithRendererOptions,
+		},
 	}
+}
 
-	// TODO: support io.* functions?
-
-	loaders, _ := l.GetField(l.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable)
-	loaders.Append(l.NewFunction(fsLoader))
-
+func (e *dynamic) Extend(m goldmark.Markdown) {
+	config := &RuntimeConfig{
+		FS:          e.fs,
+		OnError:     e.onError,
+		GoModules:   e.goModules,
+		LuaModules:  e.luaModules,
+		Logger:      e.logger,
+		PrintOutput: e.printOutput,
+		LuaDebugger: e.luaDebugger,
+		LuaCoverage: e.luaCoverage,
+	}
+	scopes := &documentScopes{frontMatter: e.frontMatter}
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&documentVarsTransformer{}, documentVarsPriority),
+		util.Prioritized(&documentMetaTransformer{}, documentVarsPriority),
+		util.Prioritized(&documentScopeTransformer{scopes: scopes}, documentVarsPriority),
+	))
+	runtimes := map[RuntimeFactory]Runtime{}
 	for _, extension := range e.extensions {
-		fn, err := loadLuaFileFS(l, e.fs, extension.File)
-		if err != nil {
-			e.onError(err)
+		var factory RuntimeFactory
+		for _, f := range e.factories {
+			if f.CanLoad(extension.File) {
+				factory = f
+				break
+			}
 		}
-		if err := l.CallByParam(lua.P{
-			Fn:      fn,
-			NRet:    1,
-			Protect: true,
-		}); err != nil {
-			e.onError(err)
+		if factory == nil {
+			e.onError(fmt.Errorf("%s: no runtimes can load this file", extension.File))
+			continue
 		}
-		ret := l.Get(-1)
-		l.Pop(1)
-		if _, err := mustLValue(ret, lua.LTFunction); err != nil {
-			e.onError(fmt.Errorf("goldmark-dynamic lua extension returns an invalid value: %w", err))
-			return
+		r, ok := runtimes[factory]
+		if !ok {
+			r = factory.New(config)
+			runtimes[factory] = r
+			e.runtimes = append(e.runtimes, r)
 		}
-
-		if err := l.CallByParam(lua.P{
-			Fn:      ret.(*lua.LFunction),
-			NRet:    1,
-			Protect: true,
-		}, luar.New(l, m), luar.New(l, extension.Options)); err != nil {
-			e.onError(err)
+		scope := &extensionScope{
+			name:          extension.name(),
+			file:          extension.File,
+			priority:      extension.Priority,
+			scopes:        scopes,
+			registrations: &e.registrations,
+			metrics:       e.metrics,
+			tracer:        e.tracer,
 		}
-	}
-}
-
-func loadLuaFileFS(l *lua.LState, f fs.FS, path string) (*lua.LFunction, error) {
-	file, err := f.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	reader := bufio.NewReader(file)
-	c, err := reader.ReadByte()
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	if c == byte('#') {
-		_, _, err = reader.ReadLine()
-		if err != nil {
-			return nil, err
+		ctx, span := scope.startSpan(context.Background(), SpanLoad)
+		scope.ctx = ctx
+		exports, err := r.Load(&extensionMarkdown{Markdown: m, scope: scope}, extension)
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
 		}
-	}
-
-	if err != io.EOF {
-		err = reader.UnreadByte()
 		if err != nil {
-			return nil, err
+			e.onError(err)
 		}
-	}
-
-	return l.Load(reader, path)
-}
-
-type propTable struct {
-	l       *lua.LState
-	Name    string
-	Table   *lua.LTable
-	onError func(error)
-}
-
-func newPropTable(l *lua.LState, name string, table *lua.LTable, onError func(error)) *propTable {
-	return &propTable{
-		l:       l,
-		Name:    name,
-		Table:   table,
-		onError: onError,
-	}
-}
-
-func (t *propTable) Get(key string, types ...lua.LValueType) lua.LValue {
-	lv, err := mustLValue(t.l.GetField(t.Table, key), types...)
-	if err != nil {
-		t.onError(fmt.Errorf("%s.%s: %w", t.Name, key, err))
-	}
-	return lv
-}
-
-func (t *propTable) Bool(key string) bool {
-	lv := t.l.GetField(t.Table, key)
-	return !lua.LVIsFalse(lv)
-}
-
-func (t *propTable) Bytes(key string) []byte {
-	lv := t.Get(key, lua.LTString)
-	var bs []byte
-	if lv != lua.LNil {
-		bs = []byte(string(lv.(lua.LString)))
-	}
-	return bs
-}
-
-func (t *propTable) Int(key string) int {
-	lv := t.Get(key, lua.LTNumber)
-	if lv == lua.LNil {
-		return 0
-	}
-	return int(lv.(lua.LNumber))
-}
-
-func mustLValue(v lua.LValue, types ...lua.LValueType) (lua.LValue, error) {
-	for _, typ := range types {
-		if v.Type() == typ {
-			return v, nil
+		for name, fn := range exports {
+			e.exports[name] = fn
 		}
 	}
-	var buf []string
-	for _, typ := range types {
-		buf = append(buf, typ.String())
+	if e.onConflict != nil {
+		for _, c := range e.Conflicts() {
+			e.onConflict(c)
+		}
 	}
-	return lua.LNil, fmt.Errorf("must be a %s", strings.Join(buf, " or "))
 }
@@ -1,10 +1,28 @@
 package dynamic_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	. "github.com/yuin/goldmark-dynamic"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/testutil"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	lua "github.com/yuin/gopher-lua"
 
 	"github.com/yuin/goldmark"
 )
@@ -66,4 +84,1918 @@ bbbb
 		},
 		t,
 	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          2,
+			Description: "Mentions at the end of a line",
+			Markdown: `
+# hello @yuin
+`,
+			Expected: `
+<h1>hello <span class="user-mention">@yuin</span></h1>
+`,
+		},
+		t,
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          3,
+			Description: "Mentions matched by regular expressions",
+			Markdown: `
+@ゆいん, @yuin. @ aaa
+`,
+			Expected: `
+<p><span class="user-mention">@ゆいん</span>, <span class="user-mention">@yuin</span>. @ aaa</p>
+`,
+		},
+		t,
+	)
+}
+
+func TestSyntaxRules(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/syntax_rules.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Declarative inline patterns and fenced blocks",
+			Markdown: `
+aaa #goldmark bbb
+
++++ Click <here>
+*ccc* #ゆいん
++++
+
+%%%
+<b>raw</b>
+  *text*
+%%%
+`,
+			Expected: `
+<p>aaa <a class="hashtag" href="/tags/goldmark">#goldmark</a> bbb</p>
+<details><summary>Click &lt;here&gt;</summary>
+<p><em>ccc</em> <a class="hashtag" href="/tags/ゆいん">#ゆいん</a></p>
+</details>
+<pre class="verbatim">&lt;b&gt;raw&lt;/b&gt;
+  *text*
+</pre>
+`,
+		},
+		t,
+	)
+}
+
+func TestInlinePatternEmptyMatch(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"empty.lua": &fstest.MapFile{
+					Data: []byte(`
+local gparser = require 'goldmark.parser'
+local grenderer = require 'goldmark.renderer'
+local gutil = require 'goldmark.util'
+
+return function(m, opts)
+  local p = gparser.inlinePattern({
+    triggers = "#",
+    pattern = [[x*]],
+    kind = "LuaEmpty",
+    html = "<x>",
+  })
+  m:parser():addOptions(gparser.withInlineParsers(gutil.prioritized(p, 999)))
+  m:renderer():addOptions(grenderer.withNodeRenderers(gutil.prioritized(p:newRenderer(), 999)))
+end
+`),
+				},
+				"empty.yaml": &fstest.MapFile{
+					Data: []byte("inlines:\n  - triggers: \"@\"\n    pattern: \"y*\"\n    kind: RuleEmpty\n    html: \"<y>\"\n"),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "empty.lua",
+				},
+				{
+					File: "empty.yaml",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	done := make(chan string, 1)
+	go func() {
+		var buf bytes.Buffer
+		_ = markdown.Convert([]byte("a # b @ c\n"), &buf)
+		done <- buf.String()
+	}()
+	select {
+	case out := <-done:
+		expected := "<p>a # b @ c</p>\n"
+		if out != expected {
+			t.Errorf("expected %q, but got %q", expected, out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("patterns that match an empty string must not loop forever")
+	}
+}
+
+func TestFencedBlockUnterminatedLine(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/syntax_rules.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	for i, c := range []struct {
+		source string
+		lines  []any
+	}{
+		{"%%%\naaa\nbbb", []any{"aaa\n", "bbb"}},
+		{"%%%\r\naaa\r\nbbb", []any{"aaa\r\n", "bbb"}},
+	} {
+		source := []byte(c.source)
+		doc := markdown.Parser().Parse(text.NewReader(source))
+		m := NodeToMap(doc.FirstChild(), source)
+		if !reflect.DeepEqual(m["lines"], c.lines) {
+			t.Errorf("%d: expected %#v, but got %#v", i, c.lines, m["lines"])
+		}
+		stop := m["position"].(map[string]any)["stop"].(map[string]any)["offset"]
+		if stop != len(source) {
+			t.Errorf("%d: a position must stop at %d, but got %v", i, len(source), stop)
+		}
+	}
+}
+
+func TestRuleFiles(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/rules.yaml",
+				},
+				{
+					File: "_examples/rules.json",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Declarative rules written in YAML and JSON",
+			Markdown: `
+::: warning
+aaa :smile: ~~bbb~~
+:::
+
+:::
+[link1](/index.html)
+[link2](http://external.example.com)
+:::
+`,
+			Expected: `
+<div class="container-warning">
+<p>aaa 😄 <del>bbb</del></p>
+</div>
+<div class="container-note">
+<p><a href="/index.html">link1</a>
+<a href="http://external.example.com" rel="noopener" target="_blank">link2</a></p>
+</div>
+`,
+		},
+		t,
+	)
+}
+
+func TestPosition(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+				{
+					File:    "_examples/admonition.lua",
+					Options: map[string]string{},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	source := []byte("aaa @yuin bbb\n\n::: note\nccc\n:::\n")
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var positions []Position
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if pn, ok := n.(PositionedNode); ok && entering {
+			positions = append(positions, pn.Position())
+		}
+		return ast.WalkContinue, nil
+	})
+	expected := []Position{
+		{Start: Location{Offset: 4, Line: 1, Column: 5}, Stop: Location{Offset: 9, Line: 1, Column: 10}},
+		{Start: Location{Offset: 15, Line: 3, Column: 1}, Stop: Location{Offset: 31, Line: 5, Column: 4}},
+	}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Errorf("expected %+v, but got %+v", expected, positions)
+	}
+}
+
+func TestLuaPosition(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"position.lua": &fstest.MapFile{
+					Data: []byte(`
+local gast = require 'goldmark.ast'
+local gparser = require 'goldmark.parser'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+local gutil = require 'goldmark.util'
+
+local kindPos = gast.newNodeKind("Pos")
+
+local function location(l)
+  return string.format("%d:%d:%d", l.offset, l.line, l.column)
+end
+
+return function(m, opts)
+  local p = gparser.inlinePattern({
+    triggers = "$",
+    pattern = [[\$\w+]],
+    kind = kindPos,
+  })
+  local r = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(kindPos, function(w, source, n, entering)
+        if entering then
+          local pos = n:position()
+          w:writeString(string.format('<span data-start="%s" data-stop="%s"></span>',
+            location(pos.start), location(pos.stop)))
+        end
+        return gast.walkContinue, nil
+      end)
+    end
+  })
+  m:parser():addOptions(gparser.withInlineParsers(gutil.prioritized(p, 999)))
+  m:renderer():addOptions(grenderer.withNodeRenderers(gutil.prioritized(r, 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "position.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "n:position() in Lua",
+			Markdown: `
+aaa $abc
+
+bb $d
+`,
+			Expected: `
+<p>aaa <span data-start="5:2:5" data-stop="9:2:9"></span></p>
+<p>bb <span data-start="14:4:4" data-stop="16:4:6"></span></p>`,
+		},
+		t,
+	)
+}
+
+func TestNodeToJSON(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	source := []byte("# @yuin san\n")
+	doc := markdown.Parser().Parse(text.NewReader(source))
+	actual, err := NodeToJSON(doc, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"children":[{"children":[{"children":[],"kind":"mention",` +
+		`"position":{"start":{"column":3,"line":1,"offset":2},"stop":{"column":8,"line":1,"offset":7}},` +
+		`"props":{"name":"yuin"},"type":"inline"},{"children":[],"kind":"Text","props":{"segment":" san"},"type":"inline"}],` +
+		`"kind":"Heading","props":{"level":1},"type":"block"}],` +
+		`"kind":"Document","type":"document"}`
+	if string(actual) != expected {
+		t.Errorf("expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestNodeToJSONCyclicProps(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"cyclic.lua": &fstest.MapFile{
+					Data: []byte(`
+local gast = require 'goldmark.ast'
+local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+
+return function(m, opts)
+  local cyclicInlineParser = gparser.newInlineParser({
+    triggers = "!",
+    parse = function(self, parent, block, pc)
+      block:advance(1)
+      local props = { name = "cyclic" }
+      props.self = props
+      return gast.newInlineNode({
+        kind = gast.newNodeKind("cyclic"),
+        props = props
+      })
+    end
+  })
+  m:parser():addOptions(
+    gparser.withInlineParsers(gutil.prioritized(cyclicInlineParser, 999))
+  )
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "cyclic.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	source := []byte("!\n")
+	doc := markdown.Parser().Parse(text.NewReader(source))
+	actual, err := NodeToJSON(doc.FirstChild().FirstChild(), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"children":[],"kind":"cyclic","position":` +
+		`{"start":{"column":1,"line":1,"offset":0},"stop":{"column":2,"line":1,"offset":1}},` +
+		`"props":{"name":"cyclic","self":null},"type":"inline"}`
+	if string(actual) != expected {
+		t.Errorf("expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestJavaScript(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/admonition.js",
+					Options: map[string]string{
+						"prefix": "admonition-",
+					},
+				},
+				{
+					File: "_examples/mention.lua",
+					Options: map[string]string{
+						"class": "user-mention",
+					},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "JavaScript extensions with Lua extensions",
+			Markdown: `
+::: note
+bbbb @yuin
+*ccc*
+:::
+
+:::
+ddd
+:::
+`,
+			Expected: `
+<div class="admonition-note"><p>bbbb <span class="user-mention">@yuin</span>
+<em>ccc</em></p>
+</div><div class="admonition-admonition"><p>ddd</p>
+</div>`,
+		},
+		t,
+	)
+}
+
+func TestStarlark(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/admonition.star",
+					Options: map[string]string{
+						"prefix": "admonition-",
+					},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Starlark extensions",
+			Markdown: `
+::: note
+bbbb
+*ccc*
+:::
+`,
+			Expected: `
+<div class="admonition-note"><p>bbbb
+<em>ccc</em></p>
+</div>`,
+		},
+		t,
+	)
+}
+
+func TestStarlarkCompareGoValues(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	var errs []error
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"compare.star": &fstest.MapFile{
+					Data: []byte(`load("values", "p1", "p2", "s1", "s2")
+
+def extend(m, opts):
+    if p1 != p2:
+        fail("structs must be compared by values")
+    if s1 == s2:
+        fail("slices must not be compared")
+`),
+				},
+			}),
+			WithGoModule("values", map[string]any{
+				"p1": point{1, 2},
+				"p2": point{1, 2},
+				"s1": []string{"a"},
+				"s2": []string{"a"},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "compare.star",
+				},
+			}),
+			WithOnError(func(err error) {
+				errs = append(errs, err)
+			}),
+		)
+	defer cleanup()
+	_ = goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "not comparable") {
+		t.Errorf("slices must not be comparable, but got %v", errs)
+	}
+}
+
+func TestStarlarkFrozenGlobals(t *testing.T) {
+	var errs []error
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"counter.star": &fstest.MapFile{
+					Data: []byte("counter = []\n\ndef extend(m, opts):\n    counter.append(1)\n"),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "counter.star",
+				},
+			}),
+			WithOnError(func(err error) {
+				errs = append(errs, err)
+			}),
+		)
+	defer cleanup()
+	_ = goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "frozen") {
+		t.Errorf("globals must be frozen, but got %v", errs)
+	}
+}
+
+// buildWasmExample builds _examples/wasm/<name> into the dir as
+// <name>.wasm.
+func buildWasmExample(tb testing.TB, dir, name string) {
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(dir, name+".wasm"), ".")
+	cmd.Dir = filepath.Join("_examples", "wasm", name)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// CI sets this on Go versions that can build the example.
+		if os.Getenv("GOLDMARK_DYNAMIC_REQUIRE_WASM") == "true" {
+			tb.Fatalf("can not build a wasm module: %s", out)
+		}
+		tb.Skipf("can not build a wasm module: %s", out)
+	}
+}
+
+func TestWasm(t *testing.T) {
+	dir := t.TempDir()
+	buildWasmExample(t, dir, "mention")
+
+	ext, cleanup :=
+		New(
+			WithFS(os.DirFS(dir).(fs.StatFS)),
+			WithExtensions([]Extension{
+				{
+					File: "mention.wasm",
+					Options: map[string]string{
+						"class": "user-mention",
+					},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "WebAssembly extensions",
+			Markdown: `
+hello @yuin and @ yuin
+`,
+			Expected: `
+<p>hello <span class="user-mention">@yuin</span> and @ yuin</p>`,
+		},
+		t,
+	)
+
+	var errs []error
+	ext2, cleanup2 :=
+		New(
+			WithFS(os.DirFS(dir).(fs.StatFS)),
+			WithOnError(func(err error) {
+				errs = append(errs, err)
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "mention.wasm",
+				},
+				{
+					File: "mention.wasm",
+				},
+			}),
+		)
+	defer cleanup2()
+	_ = goldmark.New(
+		goldmark.WithExtensions(ext2),
+	)
+	if len(errs) != 0 {
+		t.Errorf("a module must be loadable multiple times: %v", errs)
+	}
+}
+
+func TestWasmRawBlock(t *testing.T) {
+	dir := t.TempDir()
+	buildWasmExample(t, dir, "verbatim")
+
+	ext, cleanup :=
+		New(
+			WithFS(os.DirFS(dir).(fs.StatFS)),
+			WithExtensions([]Extension{
+				{
+					File: "verbatim.wasm",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	for i, c := range []struct {
+		source string
+		lines  []any
+		stop   int
+		html   string
+	}{
+		{"%%%\n<b>\n%%%\n", []any{"<b>\n"}, 11, "<pre class=\"verbatim\">&lt;b&gt;\n</pre>\n"},
+		{"%%%\naaa\nbbb", []any{"aaa\n", "bbb"}, 11, "<pre class=\"verbatim\">aaa\nbbb</pre>\n"},
+		{"%%%\r\naaa\r\nbbb", []any{"aaa\r\n", "bbb"}, 13, "<pre class=\"verbatim\">aaa\r\nbbb</pre>\n"},
+	} {
+		source := []byte(c.source)
+		doc := markdown.Parser().Parse(text.NewReader(source))
+		m := NodeToMap(doc.FirstChild(), source)
+		if !reflect.DeepEqual(m["lines"], c.lines) {
+			t.Errorf("%d: expected %#v, but got %#v", i, c.lines, m["lines"])
+		}
+		stop := m["position"].(map[string]any)["stop"].(map[string]any)["offset"]
+		if stop != c.stop {
+			t.Errorf("%d: a position must stop at %d, but got %v", i, c.stop, stop)
+		}
+		var buf bytes.Buffer
+		if err := markdown.Convert(source, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.html {
+			t.Errorf("%d: expected %q, but got %q", i, c.html, buf.String())
+		}
+	}
+}
+
+func TestHostModules(t *testing.T) {
+	loaded := false
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"mention.lua": &fstest.MapFile{
+					Data: mustReadFile(t, "_examples/mention.lua"),
+				},
+				"host.lua": &fstest.MapFile{
+					Data: []byte("local host = require 'host'\nreturn function(m, opts) host.loaded() end\n"),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File:    "mention.lua",
+					Options: map[string]string{},
+				},
+				{
+					File: "host.lua",
+				},
+			}),
+			WithGoModule("mention.users", map[string]any{
+				"profileURL": func(name string) string {
+					if name == "yuin" {
+						return "https://github.com/yuin"
+					}
+					return ""
+				},
+			}),
+			WithModule("host", func(l *lua.LState) int {
+				mod := l.NewTable()
+				mod.RawSetString("loaded", l.NewFunction(func(l *lua.LState) int {
+					loaded = true
+					return 0
+				}))
+				l.Push(mod)
+				return 1
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	if !loaded {
+		t.Error("host module must be loaded")
+	}
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Go modules provided by host applications",
+			Markdown: `
+@yuin and @someone
+`,
+			Expected: `
+<p><a class="mention" href="https://github.com/yuin">@yuin</a> and <span class="mention">@someone</span></p>`,
+		},
+		t,
+	)
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestRegisterGoRendererFuncs(t *testing.T) {
+	kbd := func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("<kbd>")
+		} else {
+			_, _ = w.WriteString("</kbd>")
+		}
+		return ast.WalkContinue, nil
+	}
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"kbd.lua": &fstest.MapFile{
+					Data: []byte(`
+local gast = require 'goldmark.ast'
+local gutil = require 'goldmark.util'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+local kbd = require 'kbd'
+local kbdud = require 'kbdud'
+
+return function(m, opts)
+  local kbdRenderer = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(gast.kindCodeSpan, kbd.func)
+      reg:register(gast.kindEmphasis, kbdud.func)
+    end
+  })
+  m:renderer():addOptions(grenderer.withNodeRenderers(gutil.prioritized(kbdRenderer, 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "kbd.lua",
+				},
+			}),
+			WithGoModule("kbd", map[string]any{
+				"func": kbd,
+			}),
+			WithModule("kbdud", func(l *lua.LState) int {
+				mod := l.NewTable()
+				ud := l.NewUserData()
+				ud.Value = renderer.NodeRendererFunc(kbd)
+				mod.RawSetString("func", ud)
+				l.Push(mod)
+				return 1
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Go functions registered by Lua",
+			Markdown:    "`Ctrl` *C*",
+			Expected:    "<p><kbd>Ctrl</kbd> <kbd>C</kbd></p>",
+		},
+		t,
+	)
+}
+
+func TestExportedFunctions(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/heading_id.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Extensions that export functions",
+			Markdown: `
+# Hello, World!
+`,
+			Expected: `
+<h1 id="hello-world">Hello, World!</h1>`,
+		},
+		t,
+	)
+
+	ret, err := ext.Call("slugify", "Call from Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ret, []any{"call-from-go"}) {
+		t.Errorf("unexpected results: %#v", ret)
+	}
+	if _, err := ext.Call("undefined"); err == nil {
+		t.Error("calling undefined functions must be an error")
+	}
+}
+
+func TestDocumentVars(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	pc := WithDocumentVars(parser.NewContext(), map[string]any{
+		"user": "yuin",
+	})
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "document variables",
+			Markdown: `
+@yuin and @someone
+`,
+			Expected: `
+<p><span class="mention mention-me">@yuin</span> and <span class="mention">@someone</span></p>`,
+		},
+		t,
+		parser.WithContext(pc),
+	)
+	if DocumentVars(pc)["user"] != "yuin" {
+		t.Errorf("document variables must be readable from a parser.Context")
+	}
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          2,
+			Description: "no document variables",
+			Markdown: `
+@yuin and @someone
+`,
+			Expected: `
+<p><span class="mention">@yuin</span> and <span class="mention">@someone</span></p>`,
+		},
+		t,
+	)
+}
+
+type documentVarsRecorder struct {
+	vars map[string]any
+}
+
+func (t *documentVarsRecorder) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	t.vars = DocumentVars(node)
+}
+
+func TestDocumentVarsTransformer(t *testing.T) {
+	ext, cleanup := New()
+	defer cleanup()
+	recorder := &documentVarsRecorder{}
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(
+				util.Prioritized(recorder, 0),
+			),
+		),
+	)
+	source := []byte("aaa")
+	pc := WithDocumentVars(parser.NewContext(), map[string]any{
+		"user": "yuin",
+	})
+	doc := markdown.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+	if recorder.vars["user"] != "yuin" {
+		t.Errorf("document variables must be readable from AST transformers")
+	}
+	b, err := NodeToJSON(doc, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "yuin") {
+		t.Errorf("document variables must not be exported as attributes: %s", b)
+	}
+}
+
+type frontMatterTransformer struct {
+	meta map[string]any
+}
+
+func (t *frontMatterTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	for key, value := range t.meta {
+		node.AddMeta(key, value)
+	}
+}
+
+func TestDocumentMeta(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/heading_id.lua",
+				},
+				{
+					File: "_examples/word_count.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(
+				util.Prioritized(&frontMatterTransformer{
+					meta: map[string]any{
+						"title":          "Document",
+						"wordsPerMinute": 2,
+					},
+				}, 0),
+			),
+		),
+	)
+
+	pc := parser.NewContext()
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "metadata produced by extensions",
+			Markdown: `
+# Hello, World!
+
+## Section
+
+aaa bbb ccc
+`,
+			Expected: `
+<h1 id="hello-world">Hello, World!</h1>
+<h2 id="section">Section</h2>
+<p>aaa bbb ccc</p>`,
+		},
+		t,
+		parser.WithContext(pc),
+	)
+	expected := map[string]any{
+		"title":          "Document",
+		"wordsPerMinute": 2,
+		"wordCount":      6,
+		"readingTime":    3,
+		"headings": []any{
+			map[string]any{"id": "hello-world", "level": 1, "text": "Hello, World!"},
+			map[string]any{"id": "section", "level": 2, "text": "Section"},
+		},
+	}
+	if actual := DocumentMeta(pc); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, actual)
+	}
+}
+
+func TestExtensionScopes(t *testing.T) {
+	var frontMatter map[string]any
+	frontMatterCalls := 0
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"mention.lua": &fstest.MapFile{
+					Data: mustReadFile(t, "_examples/mention.lua"),
+				},
+				"admonition.lua": &fstest.MapFile{
+					Data: mustReadFile(t, "_examples/admonition.lua"),
+				},
+				"kbd.lua": &fstest.MapFile{
+					Data: []byte(`
+local gast = require 'goldmark.ast'
+local gutil = require 'goldmark.util'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+
+return function(m, opts)
+  local kbdRenderer = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(gast.kindCodeSpan, function(w, source, n, entering)
+        w:writeString(entering and "<kbd>" or "</kbd>")
+        return gast.walkContinue, nil
+      end)
+    end
+  })
+  m:renderer():addOptions(grenderer.withNodeRenderers(gutil.prioritized(kbdRenderer, 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File:    "mention.lua",
+					Options: map[string]string{},
+				},
+				{
+					File:    "admonition.lua",
+					Options: map[string]string{},
+				},
+				{
+					File: "kbd.lua",
+					Name: "keyboard",
+				},
+			}),
+			WithFrontMatter(func(pc parser.Context) map[string]any {
+				frontMatterCalls++
+				return frontMatter
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	source := `
+@yuin ` + "`Ctrl`" + `
+
+::: note
+bbbb
+:::
+`
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "all extensions are enabled by default",
+			Markdown:    source,
+			Expected: `
+<p><span class="mention">@yuin</span> <kbd>Ctrl</kbd></p>
+<div class="note"><p>bbbb</p>
+</div>`,
+		},
+		t,
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          2,
+			Description: "disabled extensions",
+			Markdown:    source,
+			Expected: `
+<p>@yuin <code>Ctrl</code></p>
+<div class="note"><p>bbbb</p>
+</div>`,
+		},
+		t,
+		parser.WithContext(WithDisabledExtensions(parser.NewContext(), "mention", "keyboard")),
+	)
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          3,
+			Description: "enabled extensions",
+			Markdown:    source,
+			Expected: `
+<p><span class="mention">@yuin</span> <code>Ctrl</code></p>
+<p>::: note
+bbbb
+:::</p>`,
+		},
+		t,
+		parser.WithContext(WithEnabledExtensions(parser.NewContext(), "mention")),
+	)
+
+	frontMatter = map[string]any{
+		"disabledExtensions": []any{"admonition"},
+	}
+	frontMatterCalls = 0
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          4,
+			Description: "extensions disabled by front matter",
+			Markdown:    source,
+			Expected: `
+<p><span class="mention">@yuin</span> <kbd>Ctrl</kbd></p>
+<p>::: note
+bbbb
+:::</p>`,
+		},
+		t,
+	)
+	if frontMatterCalls != 1 {
+		t.Errorf("front matter must be read once per document, but read %d times", frontMatterCalls)
+	}
+
+	// a document that does not have front matter. Block parsers for the first
+	// line can not know whether front matter follows.
+	frontMatter = nil
+	frontMatterCalls = 0
+	var buf bytes.Buffer
+	pc := WithDisabledExtensions(parser.NewContext(), "keyboard")
+	if err := markdown.Convert([]byte(strings.Repeat("::: note\n@yuin `Ctrl`\n:::\n\n", 100)), &buf,
+		parser.WithContext(pc)); err != nil {
+		t.Fatal(err)
+	}
+	if frontMatterCalls != 2 {
+		t.Errorf("front matter must be read for the first line and once after it, but read %d times",
+			frontMatterCalls)
+	}
+
+	pc = WithDisabledExtensions(parser.NewContext(), "mention")
+	doc := markdown.Parser().Parse(text.NewReader([]byte(source)), parser.WithContext(pc))
+	for _, attr := range doc.Attributes() {
+		if _, ok := attr.Value.(parser.Context); ok {
+			t.Errorf("a parser.Context must not be kept in the AST")
+		}
+	}
+}
+
+func TestRegistrations(t *testing.T) {
+	conflicts := []string{}
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+				{
+					File: "_examples/mention.lua",
+					Options: map[string]string{
+						"class": "mention2",
+					},
+					Name:     "mention2",
+					Priority: 500,
+				},
+				{
+					File: "_examples/heading_id.lua",
+				},
+			}),
+			WithOnConflict(func(c Conflict) {
+				conflicts = append(conflicts, c.String())
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+
+	actual := []string{}
+	for _, r := range ext.Registrations() {
+		actual = append(actual, r.String())
+	}
+	expected := []string{
+		`mention: InlineParser(priority=999, triggers="@")`,
+		`mention: NodeRenderer(priority=999, kinds=mention)`,
+		`mention2: InlineParser(priority=500, triggers="@")`,
+		`mention2: NodeRenderer(priority=500, kinds=mention)`,
+		`heading_id: ASTTransformer(priority=999)`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, actual)
+	}
+
+	expected = []string{
+		`InlineParser: trigger '@' is registered by mention2(priority=500), mention(priority=999)`,
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, conflicts)
+	}
+
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "priorities overridden by Go",
+			Markdown: `
+@yuin
+`,
+			Expected: `
+<p><span class="mention2">@yuin</span></p>`,
+		},
+		t,
+	)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+			}),
+			WithMetrics(metrics),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "metrics",
+			Markdown: `
+@yuin and @alice
+`,
+			Expected: `
+<p><span class="mention">@yuin</span> and <span class="mention">@alice</span></p>`,
+		},
+		t,
+	)
+
+	// Dump writes to stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	source := []byte("@yuin")
+	markdown.Parser().Parse(text.NewReader(source)).Dump(source, 0)
+	os.Stdout = stdout
+
+	calls := map[string]int64{}
+	for _, m := range metrics.Snapshot() {
+		calls[m.Extension+" "+m.Hook+" "+m.Kind] = m.Calls
+	}
+	expected := map[string]int64{
+		"mention InlineParser.Parse ":         3,
+		"mention NodeRenderer.Render mention": 4,
+		"mention Node.Dump mention":           1,
+	}
+	for key, n := range expected {
+		if calls[key] != n {
+			t.Errorf("%s: expected %d calls, but got %d", key, n, calls[key])
+		}
+	}
+
+	var v []HookMetric
+	if err := json.Unmarshal([]byte(metrics.String()), &v); err != nil || len(v) == 0 {
+		t.Errorf("invalid JSON: %s", metrics.String())
+	}
+
+	metrics.Reset()
+	if len(metrics.Snapshot()) != 0 {
+		t.Errorf("metrics should be empty after Reset, but got %v", metrics.Snapshot())
+	}
+}
+
+type testTracer struct {
+	spans []string
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+}
+
+func (s *testSpan) RecordError(err error) {}
+
+func (s *testSpan) End() {
+	s.tracer.spans = append(s.tracer.spans, s.name)
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	if v, ok := ctx.Value(testTraceKey{}).(string); ok {
+		name = v + ">" + name
+	}
+	for _, attr := range attrs {
+		if attr.Key == AttributeExtensionFile || attr.Key == AttributeNodeKind {
+			name += " " + attr.Value
+		}
+	}
+	return context.WithValue(ctx, testTraceKey{}, name), &testSpan{tracer: t, name: name}
+}
+
+type testTraceKey struct{}
+
+func TestTracer(t *testing.T) {
+	tracer := &testTracer{}
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+				{
+					File: "_examples/heading_id.lua",
+				},
+			}),
+			WithTracer(tracer),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	expected := []string{
+		"goldmark-dynamic.Load _examples/mention.lua>goldmark-dynamic.NodeRenderer.Register _examples/mention.lua mention",
+		"goldmark-dynamic.Load _examples/mention.lua",
+		"goldmark-dynamic.Load _examples/heading_id.lua",
+	}
+	if !reflect.DeepEqual(tracer.spans, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, tracer.spans)
+	}
+
+	tracer.spans = nil
+	ctx := context.WithValue(context.Background(), testTraceKey{}, "convert")
+	pc := WithTraceContext(parser.NewContext(), ctx)
+	var b strings.Builder
+	if err := markdown.Convert([]byte("# Title\n\n@yuin\n"), &b, parser.WithContext(pc)); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"convert>goldmark-dynamic.ASTTransformer.Transform _examples/heading_id.lua",
+	}
+	if !reflect.DeepEqual(tracer.spans, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, tracer.spans)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var logs, prints bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"log.lua": &fstest.MapFile{
+					Data: []byte(`
+local glog = require 'goldmark.log'
+local gast = require 'goldmark.ast'
+local gutil = require 'goldmark.util'
+local gparser = require 'goldmark.parser'
+
+return function(m, opts)
+  print("loading", 1)
+  glog.debug("not logged")
+  glog.info("loaded", "priority", 999, "enabled", true)
+  m:parser():addOptions(gparser.withASTTransformers(gutil.prioritized(gparser.newASTTransformer({
+    transform = function(self, node, reader, pc)
+      glog.warn("transformed", {children = node:childCount()})
+    end
+  }), 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "log.lua",
+				},
+			}),
+			WithLogger(logger),
+			WithPrintOutput(&prints),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	if err := markdown.Convert([]byte("a\n\nb\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `level=INFO msg=loaded extension=log.lua priority=999 enabled=true
+level=WARN msg=transformed extension=log.lua children=2
+`
+	if logs.String() != expected {
+		t.Errorf("expected %q, but got %q", expected, logs.String())
+	}
+	if prints.String() != "loading\t1\n" {
+		t.Errorf("unexpected print output: %q", prints.String())
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	for _, c := range []struct {
+		file   string
+		script string
+	}{
+		{
+			file:   "print.js",
+			script: "module.exports = function(m, opts) {\n  print(\"loading\", 1, opts.name);\n};\n",
+		},
+		{
+			file:   "print.star",
+			script: "def extend(m, opts):\n    print(\"loading\", 1, opts[\"name\"])\n",
+		},
+	} {
+		var prints bytes.Buffer
+		ext, cleanup :=
+			New(
+				WithFS(fstest.MapFS{
+					c.file: &fstest.MapFile{
+						Data: []byte(c.script),
+					},
+				}),
+				WithExtensions([]Extension{
+					{
+						File:    c.file,
+						Options: map[string]string{"name": "print"},
+					},
+				}),
+				WithOnError(func(err error) {
+					t.Errorf("%s: %v", c.file, err)
+				}),
+				WithPrintOutput(&prints),
+			)
+		_ = goldmark.New(
+			goldmark.WithExtensions(ext),
+		)
+		cleanup()
+		if prints.String() != "loading 1 print\n" {
+			t.Errorf("%s: unexpected print output: %q", c.file, prints.String())
+		}
+	}
+}
+
+func TestLuaDebugger(t *testing.T) {
+	commands := strings.Join([]string{
+		"print count",
+		"print opts.label",
+		"print undefined",
+		"next",
+		"print count",
+		"break dbg.lua:13",
+		"breakpoints",
+		"continue",
+		"step",
+		"where",
+		"print n",
+		"finish",
+		"clear dbg.lua:13",
+		"continue",
+	}, "\n")
+	var out bytes.Buffer
+	debugger := NewLuaDebugger(strings.NewReader(commands), &out)
+	debugger.SetBreakpoint("/path/to/dbg.lua", 9)
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"dbg.lua": &fstest.MapFile{
+					Data: []byte(`local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+
+return function(m, opts)
+  m:parser():addOptions(gparser.withASTTransformers(gutil.prioritized(gparser.newASTTransformer({
+    transform = function(self, node, reader, pc)
+      local count = 0
+      local label = opts.label
+      count = node:childCount()
+      local double = function(n)
+        return n * 2
+      end
+      count = double(count)
+      node:setAttributeString("data-count", count)
+      node:setAttributeString("data-label", label)
+    end
+  }), 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File:    "dbg.lua",
+					Options: map[string]string{"label": "debug"},
+				},
+			}),
+			WithLuaDebugger(debugger),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	if err := markdown.Convert([]byte("a\n\nb\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `stopped breakpoint dbg.lua:9
+count = 0 (number)
+ok
+opts.label = "debug"
+ok
+error undefined variable: undefined
+ok
+stopped step dbg.lua:10
+count = 2 (number)
+ok
+ok
+/path/to/dbg.lua:9
+dbg.lua:13
+ok
+ok
+stopped breakpoint dbg.lua:13
+ok
+stopped step dbg.lua:11
+dbg.lua:11 in function <dbg.lua:10>
+dbg.lua:13 in function <dbg.lua:6>
+ok
+n = 2 (number)
+ok
+ok
+stopped step dbg.lua:14
+ok
+ok
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestLuaDebuggerPause(t *testing.T) {
+	var out bytes.Buffer
+	// the debugger is detached when commands reach EOF.
+	debugger := NewLuaDebugger(strings.NewReader(""), &out)
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/mention.lua",
+					Options: map[string]string{},
+				},
+			}),
+			WithLuaDebugger(debugger),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	debugger.Pause()
+	done := make(chan struct{})
+	paused := make(chan struct{})
+	go func() {
+		defer close(paused)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				debugger.Pause()
+			}
+		}
+	}()
+	err := markdown.Convert([]byte(strings.Repeat("@yuin\n\n", 100)), &bytes.Buffer{})
+	close(done)
+	<-paused
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "stopped") != 1 {
+		t.Errorf("a detached debugger must not stop, but got:\n%s", out.String())
+	}
+}
+
+func TestLuaCoverage(t *testing.T) {
+	coverage := NewLuaCoverage()
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"cov.lua": &fstest.MapFile{
+					Data: []byte(`local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+
+return function(m, opts)
+  m:parser():addOptions(gparser.withASTTransformers(gutil.prioritized(gparser.newASTTransformer({
+    transform = function(self, node, reader, pc)
+      if node:childCount() > 10 then
+        node:setAttributeString("class", "long")
+      end
+    end
+  }), 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "cov.lua",
+				},
+			}),
+			WithLuaCoverage(coverage),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	for i := 0; i < 2; i++ {
+		if err := markdown.Convert([]byte("a\n"), &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if err := coverage.WriteLcov(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:cov.lua
+DA:1,1
+DA:2,1
+DA:4,1
+DA:5,1
+DA:7,2
+DA:8,0
+LF:6
+LH:5
+end_of_record
+`
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+	if p := coverage.Percent(); int(p) != 83 {
+		t.Errorf("expected 83%%, but got %f", p)
+	}
+}
+
+func TestDelimiterProcessor(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File:    "_examples/highlight.lua",
+					Options: map[string]string{},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "highlight",
+			Markdown: `
+==Hello== world, a == b, ==**nested** text== and =single=
+`,
+			Expected: `
+<p><mark>Hello</mark> world, a == b, <mark><strong>nested</strong> text</mark> and =single=</p>`,
+		},
+		t,
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          2,
+			Description: "unclosed delimiter",
+			Markdown: `
+==unclosed
+`,
+			Expected: `
+<p>==unclosed</p>`,
+		},
+		t,
+	)
+}
+
+func TestLuaReader(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"var.lua": &fstest.MapFile{
+					Data: []byte(`
+local gast = require 'goldmark.ast'
+local gparser = require 'goldmark.parser'
+local grenderer = require 'goldmark.renderer'
+local hrenderer = require 'goldmark.renderer.html'
+local gutil = require 'goldmark.util'
+local gregexp = require 'go.regexp'
+
+local kindVar = gast.newNodeKind("Var")
+local bang = gregexp.compile([[^!!+]])
+
+-- {{name}} or {{name:type}}, and !! as a bool var
+return function(m, opts)
+  local p = gparser.newInlineParser({
+    triggers = "{!",
+    parse = function(self, parent, block, pc)
+      if block:peek() == 33 then
+        -- text.Reader.Match advances the reader and returns a bool
+        if not block:match(bang) then
+          return nil
+        end
+        assert(block:lineNumber() == block:lineNumber(pc))
+        return gast.newInlineNode({
+          kind = kindVar,
+          props = { name = "bang", type = "bool", line = block:lineNumber() }
+        })
+      end
+      local mark = block:mark()
+      if block:peek() ~= 123 or block:peek(2) ~= "{{" then
+        return nil
+      end
+      local name, typ = block:matchCaptures([[\{\{(\w+)(?::(\w+))?]])
+      if not name then
+        return nil
+      end
+      block:consume([[\{\{\w+]])
+      if typ then
+        block:advance(1)
+        block:readUntil("}")
+      end
+      if block:peek(2) ~= "}}" then
+        block:reset(mark)
+        return nil
+      end
+      block:advance(2)
+      return gast.newInlineNode({
+        kind = kindVar,
+        props = { name = name, type = typ or "any", line = block:lineNumber(pc) }
+      })
+    end
+  })
+  local r = hrenderer.newRenderer({
+    registerFuncs = function(self, reg)
+      reg:register(kindVar, function(w, source, n, entering)
+        if entering then
+          w:writeString(string.format('<var data-type="%s" data-line="%d">%s</var>',
+            n:prop("type"), n:prop("line"), n:prop("name")))
+        end
+        return gast.walkContinue, nil
+      end)
+    end
+  })
+  m:parser():addOptions(gparser.withInlineParsers(gutil.prioritized(p, 999)))
+  m:renderer():addOptions(grenderer.withNodeRenderers(gutil.prioritized(r, 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "var.lua",
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	testutil.DoTestCase(
+		markdown,
+		testutil.MarkdownTestCase{
+			No:          1,
+			Description: "Lua friendly reader",
+			Markdown: `
+# Title
+
+{{user}} and {{count:int}}
+{{broken and {{unclosed:int
+!!! and !
+`,
+			Expected: `
+<h1>Title</h1>
+<p><var data-type="any" data-line="4">user</var> and <var data-type="int" data-line="4">count</var>
+{{broken and {{unclosed:int
+<var data-type="bool" data-line="6">bang</var> and !</p>`,
+		},
+		t,
+	)
+}
+
+func TestLuaReaderPeekNegative(t *testing.T) {
+	var errs []error
+	ext, cleanup :=
+		New(
+			WithFS(fstest.MapFS{
+				"peek.lua": &fstest.MapFile{
+					Data: []byte(`
+local gparser = require 'goldmark.parser'
+local gutil = require 'goldmark.util'
+
+return function(m, opts)
+  local p = gparser.newInlineParser({
+    triggers = "!",
+    parse = function(self, parent, block, pc)
+      block:peek(-1)
+      return nil
+    end
+  })
+  m:parser():addOptions(gparser.withInlineParsers(gutil.prioritized(p, 999)))
+end
+`),
+				},
+			}),
+			WithExtensions([]Extension{
+				{
+					File: "peek.lua",
+				},
+			}),
+			WithOnError(func(err error) {
+				errs = append(errs, err)
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte("a!\n"), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "<p>a!</p>\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "must not be negative") {
+		t.Errorf("a negative length must be an error, but got %v", errs)
+	}
+}
+
+func TestParserContext(t *testing.T) {
+	ext, cleanup :=
+		New(
+			WithExtensions([]Extension{
+				{
+					File: "_examples/wiki_link.lua",
+					Options: map[string]string{
+						"base": "/wiki/",
+					},
+				},
+			}),
+		)
+	defer cleanup()
+	markdown := goldmark.New(
+		goldmark.WithExtensions(ext),
+	)
+	pc := parser.NewContext()
+	var b strings.Builder
+	if err := markdown.Convert([]byte(`
+See [[Go Lang]], [[goldmark|the parser]] and [[Missing Page]].
+[[not closed] and [a link][goldmark].
+
+[go lang]: https://go.dev "The Go <Programming> Language"
+[goldmark]: https://github.com/yuin/goldmark
+`), &b, parser.WithContext(pc)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<p>See <a class="wiki-link" href="https://go.dev" title="The Go &lt;Programming&gt; Language">Go Lang</a>, ` +
+		`<a class="wiki-link" href="https://github.com/yuin/goldmark">the parser</a> and ` +
+		`<a class="wiki-link" href="/wiki/Missing_Page">Missing Page</a>.
+[[not closed] and <a href="https://github.com/yuin/goldmark">a link</a>.</p>
+`
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+	missing := DocumentMeta(pc)["missingWikiLinks"]
+	if !reflect.DeepEqual(missing, []any{"Missing Page"}) {
+		t.Errorf("unexpected missing links: %#v", missing)
+	}
 }
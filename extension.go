@@ -0,0 +1,544 @@
+package dynamic
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// name returns a name of the extension. This defaults to a base name of the
+// file without an extension.
+func (e Extension) name() string {
+	if len(e.Name) != 0 {
+		return e.Name
+	}
+	base := path.Base(e.File)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+var enabledExtensionsKey = parser.NewContextKey()
+
+var disabledExtensionsKey = parser.NewContextKey()
+
+var documentScopeKey = parser.NewContextKey()
+
+// documentScopeAttribute is a name of an attribute of ast.Document that
+// holds a documentScope while rendering. This is set only if some extensions
+// are disabled for the document.
+var documentScopeAttribute = []byte(internalAttributePrefix + "scope")
+
+// WithEnabledExtensions enables only the given extensions for documents
+// parsed with the pc and returns the pc. Names are [Extension].Name.
+func WithEnabledExtensions(pc parser.Context, names ...string) parser.Context {
+	pc.Set(enabledExtensionsKey, names)
+	return pc
+}
+
+// WithDisabledExtensions disables the given extensions for documents parsed
+// with the pc and returns the pc. Names are [Extension].Name.
+func WithDisabledExtensions(pc parser.Context, names ...string) parser.Context {
+	pc.Set(disabledExtensionsKey, names)
+	return pc
+}
+
+// WithFrontMatter is an option that sets a function that returns front
+// matter of the document(e.g. meta.Get of goldmark-meta).
+// Extensions can be enabled or disabled per document by 'enabledExtensions'
+// and 'disabledExtensions' keys of front matter.
+func WithFrontMatter(f func(parser.Context) map[string]any) Option {
+	return func(e *dynamic) {
+		e.frontMatter = f
+	}
+}
+
+// documentScopes decides extensions that are enabled for each document.
+type documentScopes struct {
+	frontMatter func(parser.Context) map[string]any
+
+	// restricted is set when extensions are disabled for a document.
+	// Renderers do not look up documents until then.
+	restricted atomic.Bool
+}
+
+// documentScope is a set of extensions that are enabled for a document.
+type documentScope struct {
+	// enabled is nil if all extensions that are not disabled are enabled.
+	enabled  map[string]bool
+	disabled map[string]bool
+
+	// final is false while front matter may not be parsed yet, that is,
+	// while the first line of a document is parsed.
+	final bool
+}
+
+var (
+	allExtensions        = &documentScope{final: true}
+	pendingAllExtensions = &documentScope{}
+)
+
+func (d *documentScope) all() bool {
+	return d.enabled == nil && len(d.disabled) == 0
+}
+
+func (d *documentScope) allows(name string) bool {
+	if d.enabled != nil && !d.enabled[name] {
+		return false
+	}
+	return !d.disabled[name]
+}
+
+// get returns a documentScope of a document parsed with the pc. A decision
+// is cached in the pc. Front matter starts at the first line of a document,
+// so it has been parsed unless final is false(i.e. block parsers are called
+// for the first line). A decision that is not final is made again in the
+// next call.
+func (s *documentScopes) get(pc parser.Context, final bool) *documentScope {
+	if d, ok := pc.Get(documentScopeKey).(*documentScope); ok && d.final {
+		return d
+	}
+	d := s.decide(pc, final)
+	pc.Set(documentScopeKey, d)
+	return d
+}
+
+func (s *documentScopes) decide(pc parser.Context, final bool) *documentScope {
+	enabled, _ := pc.Get(enabledExtensionsKey).([]string)
+	disabled, _ := pc.Get(disabledExtensionsKey).([]string)
+	final = final || s.frontMatter == nil
+	if s.frontMatter != nil {
+		if fm := s.frontMatter(pc); fm != nil {
+			final = true
+			if v, ok := fm["enabledExtensions"]; ok {
+				enabled = toStrings(v)
+			}
+			if v, ok := fm["disabledExtensions"]; ok {
+				disabled = append(disabled, toStrings(v)...)
+			}
+		}
+	}
+	if enabled == nil && len(disabled) == 0 {
+		if final {
+			return allExtensions
+		}
+		return pendingAllExtensions
+	}
+	d := &documentScope{disabled: toSet(disabled), final: final}
+	if enabled != nil {
+		d.enabled = toSet(enabled)
+	}
+	s.restricted.Store(true)
+	return d
+}
+
+// extensionScope decides whether an extension is enabled for documents and
+// records registrations of the extension.
+type extensionScope struct {
+	name          string
+	file          string
+	priority      int
+	scopes        *documentScopes
+	registrations *[]Registration
+	metrics       *Metrics
+	tracer        Tracer
+
+	// ctx is a context that has a span of loading the extension.
+	ctx context.Context
+}
+
+// counter returns a counter of the hook. counter returns nil if metrics are
+// disabled.
+func (s *extensionScope) counter(hook, kind string) *hookCounter {
+	return s.metrics.counter(s.name, hook, kind)
+}
+
+// register records a registration and returns a priority of it.
+func (s *extensionScope) register(typ RegistrationType, priority int, triggers []byte,
+	kinds []ast.NodeKind) int {
+	if s.priority != 0 {
+		priority = s.priority
+	}
+	*s.registrations = append(*s.registrations, Registration{
+		Extension: s.name,
+		Type:      typ,
+		Priority:  priority,
+		Triggers:  triggers,
+		Kinds:     kinds,
+	})
+	return priority
+}
+
+// enabled returns true if the extension is enabled for a document parsed
+// with the pc. This must be called after block parsing.
+func (s *extensionScope) enabled(pc parser.Context) bool {
+	if pc == nil {
+		return true
+	}
+	return s.scopes.get(pc, true).allows(s.name)
+}
+
+// enabledAt is enabled for block parsers that are called while block
+// parsing.
+func (s *extensionScope) enabledAt(reader text.Reader, pc parser.Context) bool {
+	if pc == nil {
+		return true
+	}
+	line, _ := reader.Position()
+	return s.scopes.get(pc, line > 0).allows(s.name)
+}
+
+// enabledIn returns true if the extension is enabled for a document that
+// has the node.
+func (s *extensionScope) enabledIn(node ast.Node) bool {
+	if !s.scopes.restricted.Load() {
+		return true
+	}
+	doc := node.OwnerDocument()
+	if doc == nil {
+		return true
+	}
+	v, _ := doc.AttributeString(string(documentScopeAttribute))
+	d, ok := v.(*documentScope)
+	return !ok || d.allows(s.name)
+}
+
+// countedNode is a node that records metrics of its hooks.
+type countedNode interface {
+	setCounters(isRaw, dump *hookCounter)
+}
+
+// observeNode sets counters of hooks to the node created by the extension.
+func (s *extensionScope) observeNode(node ast.Node) {
+	if s.metrics == nil || node == nil {
+		return
+	}
+	if n, ok := node.(countedNode); ok {
+		kind := node.Kind().String()
+		n.setCounters(s.counter(HookNodeIsRaw, kind), s.counter(HookNodeDump, kind))
+	}
+}
+
+func toStrings(v any) []string {
+	switch vs := v.(type) {
+	case string:
+		return []string{vs}
+	case []string:
+		return vs
+	case []any:
+		ret := make([]string, 0, len(vs))
+		for _, v := range vs {
+			if s, ok := v.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return []string{}
+}
+
+func toSet(list []string) map[string]bool {
+	ret := make(map[string]bool, len(list))
+	for _, v := range list {
+		ret[v] = true
+	}
+	return ret
+}
+
+// documentScopeTransformer makes a final decision of enabled extensions
+// if no hooks have made it, and links the decision to the document if
+// some extensions are disabled, so renderers can decide whether extensions
+// are enabled.
+type documentScopeTransformer struct {
+	scopes *documentScopes
+}
+
+func (t *documentScopeTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	d := t.scopes.get(pc, true)
+	if !d.all() {
+		node.SetAttribute(documentScopeAttribute, d)
+	}
+}
+
+// extensionMarkdown is a goldmark.Markdown that is passed to an extension.
+// Parsers, transformers and renderers added by the extension are scoped by
+// the extension.
+type extensionMarkdown struct {
+	goldmark.Markdown
+	scope *extensionScope
+}
+
+func (m *extensionMarkdown) Parser() parser.Parser {
+	return &extensionParser{Parser: m.Markdown.Parser(), scope: m.scope}
+}
+
+func (m *extensionMarkdown) Renderer() renderer.Renderer {
+	return &extensionRenderer{Renderer: m.Markdown.Renderer(), scope: m.scope}
+}
+
+type extensionParser struct {
+	parser.Parser
+	scope *extensionScope
+}
+
+func (p *extensionParser) AddOptions(opts ...parser.Option) {
+	for _, opt := range opts {
+		config := parser.NewConfig()
+		opt.SetParserOption(config)
+		for name, value := range config.Options {
+			p.Parser.AddOptions(parser.WithOption(name, value))
+		}
+		if config.EscapedSpace {
+			p.Parser.AddOptions(parser.WithEscapedSpace())
+		}
+		for _, v := range config.BlockParsers {
+			bp := v.Value.(parser.BlockParser)
+			priority := p.scope.register(RegistrationBlockParser, v.Priority, bp.Trigger(), nil)
+			p.Parser.AddOptions(parser.WithBlockParsers(util.Prioritized(&scopedBlockParser{
+				BlockParser: bp,
+				scope:       p.scope,
+				open:        p.scope.counter(HookBlockParserOpen, ""),
+				cont:        p.scope.counter(HookBlockParserContinue, ""),
+				close:       p.scope.counter(HookBlockParserClose, ""),
+			}, priority)))
+		}
+		for _, v := range config.InlineParsers {
+			ip := v.Value.(parser.InlineParser)
+			priority := p.scope.register(RegistrationInlineParser, v.Priority, ip.Trigger(), nil)
+			p.Parser.AddOptions(parser.WithInlineParsers(util.Prioritized(&scopedInlineParser{
+				InlineParser: ip,
+				scope:        p.scope,
+				parse:        p.scope.counter(HookInlineParserParse, ""),
+				closeBlock:   p.scope.counter(HookInlineParserCloseBlock, ""),
+			}, priority)))
+		}
+		for _, v := range config.ParagraphTransformers {
+			priority := p.scope.register(RegistrationParagraphTransformer, v.Priority, nil, nil)
+			p.Parser.AddOptions(parser.WithParagraphTransformers(util.Prioritized(&scopedParagraphTransformer{
+				ParagraphTransformer: v.Value.(parser.ParagraphTransformer),
+				scope:                p.scope,
+				transform:            p.scope.counter(HookParagraphTransformerTransform, ""),
+			}, priority)))
+		}
+		for _, v := range config.ASTTransformers {
+			priority := p.scope.register(RegistrationASTTransformer, v.Priority, nil, nil)
+			p.Parser.AddOptions(parser.WithASTTransformers(util.Prioritized(&scopedASTTransformer{
+				ASTTransformer: v.Value.(parser.ASTTransformer),
+				scope:          p.scope,
+				transform:      p.scope.counter(HookASTTransformerTransform, ""),
+			}, priority)))
+		}
+	}
+}
+
+type extensionRenderer struct {
+	renderer.Renderer
+	scope *extensionScope
+}
+
+func (r *extensionRenderer) AddOptions(opts ...renderer.Option) {
+	for _, opt := range opts {
+		config := renderer.NewConfig()
+		opt.SetConfig(config)
+		for name, value := range config.Options {
+			r.Renderer.AddOptions(renderer.WithOption(name, value))
+		}
+		for _, v := range config.NodeRenderers {
+			// functions are registered here to know kinds that are rendered by
+			// the renderer.
+			nr := &scopedNodeRenderer{NodeRenderer: v.Value.(renderer.NodeRenderer), scope: r.scope}
+			nr.NodeRenderer.RegisterFuncs(&tracedRegisterer{reg: &nr.funcs, scope: r.scope})
+			kinds := make([]ast.NodeKind, 0, len(nr.funcs))
+			for _, f := range nr.funcs {
+				kinds = append(kinds, f.kind)
+			}
+			priority := r.scope.register(RegistrationNodeRenderer, v.Priority, nil, kinds)
+			r.Renderer.AddOptions(renderer.WithNodeRenderers(util.Prioritized(nr, priority)))
+		}
+	}
+}
+
+type scopedBlockParser struct {
+	parser.BlockParser
+	scope *extensionScope
+
+	open, cont, close *hookCounter
+}
+
+func (s *scopedBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if !s.scope.enabledAt(reader, pc) {
+		return nil, parser.Close
+	}
+	defer s.open.observe(s.open.start())
+	node, state := s.BlockParser.Open(parent, reader, pc)
+	s.scope.observeNode(node)
+	return node, state
+}
+
+func (s *scopedBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	defer s.cont.observe(s.cont.start())
+	return s.BlockParser.Continue(node, reader, pc)
+}
+
+func (s *scopedBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	defer s.close.observe(s.close.start())
+	s.BlockParser.Close(node, reader, pc)
+}
+
+func (s *scopedBlockParser) SetOption(name parser.OptionName, value any) {
+	if so, ok := s.BlockParser.(parser.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+}
+
+type scopedInlineParser struct {
+	parser.InlineParser
+	scope *extensionScope
+
+	parse, closeBlock *hookCounter
+}
+
+func (s *scopedInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if !s.scope.enabled(pc) {
+		return nil
+	}
+	defer s.parse.observe(s.parse.start())
+	node := s.InlineParser.Parse(parent, block, pc)
+	s.scope.observeNode(node)
+	return node
+}
+
+func (s *scopedInlineParser) CloseBlock(parent ast.Node, block text.Reader, pc parser.Context) {
+	if cb, ok := s.InlineParser.(parser.CloseBlocker); ok && s.scope.enabled(pc) {
+		defer s.closeBlock.observe(s.closeBlock.start())
+		cb.CloseBlock(parent, block, pc)
+	}
+}
+
+func (s *scopedInlineParser) SetOption(name parser.OptionName, value any) {
+	if so, ok := s.InlineParser.(parser.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+}
+
+type scopedParagraphTransformer struct {
+	parser.ParagraphTransformer
+	scope *extensionScope
+
+	transform *hookCounter
+}
+
+func (s *scopedParagraphTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	if s.scope.enabled(pc) {
+		defer s.transform.observe(s.transform.start())
+		s.ParagraphTransformer.Transform(node, reader, pc)
+	}
+}
+
+type scopedASTTransformer struct {
+	parser.ASTTransformer
+	scope *extensionScope
+
+	transform *hookCounter
+}
+
+func (s *scopedASTTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	if s.scope.enabled(pc) {
+		if _, span := s.scope.startSpan(traceContext(pc), SpanASTTransformerTransform); span != nil {
+			defer span.End()
+		}
+		defer s.transform.observe(s.transform.start())
+		s.ASTTransformer.Transform(node, reader, pc)
+	}
+}
+
+// scopedNodeRenderer renders nodes by the default HTML renderer if the
+// extension is disabled.
+type scopedNodeRenderer struct {
+	renderer.NodeRenderer
+	scope    *extensionScope
+	fallback renderer.NodeRenderer
+	funcs    nodeRendererFuncList
+}
+
+func (s *scopedNodeRenderer) SetOption(name renderer.OptionName, value any) {
+	if s.fallback == nil {
+		s.fallback = html.NewRenderer()
+	}
+	if so, ok := s.NodeRenderer.(renderer.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+	s.fallback.(renderer.SetOptioner).SetOption(name, value)
+}
+
+func (s *scopedNodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	if s.fallback == nil {
+		s.fallback = html.NewRenderer()
+	}
+	fallbacks := nodeRendererFuncs{}
+	s.fallback.RegisterFuncs(fallbacks)
+	scoped := &scopedRegisterer{reg: reg, scope: s.scope, fallbacks: fallbacks}
+	for _, f := range s.funcs {
+		scoped.Register(f.kind, f.f)
+	}
+}
+
+type nodeRendererFunc struct {
+	kind ast.NodeKind
+	f    renderer.NodeRendererFunc
+}
+
+type nodeRendererFuncList []nodeRendererFunc
+
+func (fs *nodeRendererFuncList) Register(kind ast.NodeKind, f renderer.NodeRendererFunc) {
+	*fs = append(*fs, nodeRendererFunc{kind: kind, f: f})
+}
+
+// tracedRegisterer starts a span per registration of a node renderer
+// function.
+type tracedRegisterer struct {
+	reg   renderer.NodeRendererFuncRegisterer
+	scope *extensionScope
+}
+
+func (r *tracedRegisterer) Register(kind ast.NodeKind, f renderer.NodeRendererFunc) {
+	if _, span := r.scope.startSpan(r.scope.ctx, SpanNodeRendererRegister,
+		SpanAttribute{Key: AttributeNodeKind, Value: kind.String()}); span != nil {
+		defer span.End()
+	}
+	r.reg.Register(kind, f)
+}
+
+type nodeRendererFuncs map[ast.NodeKind]renderer.NodeRendererFunc
+
+func (fs nodeRendererFuncs) Register(kind ast.NodeKind, f renderer.NodeRendererFunc) {
+	fs[kind] = f
+}
+
+type scopedRegisterer struct {
+	reg       renderer.NodeRendererFuncRegisterer
+	scope     *extensionScope
+	fallbacks nodeRendererFuncs
+}
+
+func (r *scopedRegisterer) Register(kind ast.NodeKind, f renderer.NodeRendererFunc) {
+	fallback := r.fallbacks[kind]
+	c := r.scope.counter(HookNodeRendererRender, kind.String())
+	r.reg.Register(kind, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if r.scope.enabledIn(n) {
+			defer c.observe(c.start())
+			return f(w, source, n, entering)
+		}
+		if fallback != nil {
+			return fallback(w, source, n, entering)
+		}
+		return ast.WalkContinue, nil
+	})
+}
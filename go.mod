@@ -1,11 +1,21 @@
 module github.com/yuin/goldmark-dynamic
 
-go 1.20
+go 1.21
 
 require (
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
-	github.com/yuin/gluamapper v0.0.0-20150323120927-d836955830e7 // indirect
-	github.com/yuin/goldmark v1.6.0 // indirect
-	github.com/yuin/gopher-lua v1.1.0 // indirect
-	layeh.com/gopher-luar v1.0.11 // indirect
+	github.com/dop251/goja v0.0.0-20260106131823-651366fbe6e3
+	github.com/tetratelabs/wazero v1.6.0
+	github.com/yuin/goldmark v1.6.0
+	github.com/yuin/gopher-lua v1.1.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	gopkg.in/yaml.v3 v3.0.1
+	layeh.com/gopher-luar v1.0.11
+)
+
+require (
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+	golang.org/x/text v0.3.8 // indirect
 )
@@ -0,0 +1,178 @@
+package dynamic
+
+import (
+	"regexp"
+
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+const maxRegexpCacheSize = 512
+
+type regexpCache struct {
+	regexps map[string]*regexp.Regexp
+}
+
+func (c *regexpCache) compile(l *lua.LState, pattern string) *regexp.Regexp {
+	if re, ok := c.regexps[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		l.RaiseError(err.Error())
+	}
+	if len(c.regexps) >= maxRegexpCacheSize {
+		c.regexps = map[string]*regexp.Regexp{}
+	}
+	c.regexps[pattern] = re
+	return re
+}
+
+func (c *regexpCache) check(l *lua.LState, n int) *regexp.Regexp {
+	switch v := l.Get(n).(type) {
+	case lua.LString:
+		return c.compile(l, string(v))
+	case *lua.LUserData:
+		if re, ok := v.Value.(*regexp.Regexp); ok {
+			return re
+		}
+	}
+	l.TypeError(n, lua.LTString)
+	return nil
+}
+
+func exportGoRegexp(l *lua.LState, opts options) {
+	l.PreloadModule("go.regexp", func(l *lua.LState) int {
+		cache := &regexpCache{regexps: map[string]*regexp.Regexp{}}
+		mod := l.NewTable()
+		l.SetFuncs(mod, map[string]lua.LGFunction{
+			"compile": func(l *lua.LState) int {
+				l.Push(luar.New(l, cache.compile(l, l.CheckString(1))))
+				return 1
+			},
+			"quote": func(l *lua.LState) int {
+				l.Push(lua.LString(regexp.QuoteMeta(l.CheckString(1))))
+				return 1
+			},
+			"isMatch": func(l *lua.LState) int {
+				re := cache.check(l, 2)
+				l.Push(lua.LBool(re.Match(checkBytes(l, 1))))
+				return 1
+			},
+			"find": func(l *lua.LState) int {
+				bs := checkBytes(l, 1)
+				re := cache.check(l, 2)
+				init := regexpInit(l, 3, len(bs))
+				loc := re.FindSubmatchIndex(bs[init:])
+				if loc == nil {
+					l.Push(lua.LNil)
+					return 1
+				}
+				l.Push(lua.LNumber(init + loc[0] + 1))
+				l.Push(lua.LNumber(init + loc[1]))
+				pushSubmatches(l, bs[init:], loc[2:])
+				return len(loc)/2 + 1
+			},
+			"match": func(l *lua.LState) int {
+				bs := checkBytes(l, 1)
+				re := cache.check(l, 2)
+				init := regexpInit(l, 3, len(bs))
+				loc := re.FindSubmatchIndex(bs[init:])
+				if loc == nil {
+					l.Push(lua.LNil)
+					return 1
+				}
+				if len(loc) == 2 {
+					l.Push(lua.LString(bs[init+loc[0] : init+loc[1]]))
+					return 1
+				}
+				pushSubmatches(l, bs[init:], loc[2:])
+				return len(loc)/2 - 1
+			},
+			"findIndex": func(l *lua.LState) int {
+				bs := checkBytes(l, 1)
+				re := cache.check(l, 2)
+				init := regexpInit(l, 3, len(bs))
+				loc := re.FindSubmatchIndex(bs[init:])
+				if loc == nil {
+					l.Push(lua.LNil)
+					return 1
+				}
+				tbl := l.CreateTable(len(loc), 0)
+				for i := 0; i < len(loc); i += 2 {
+					if loc[i] < 0 {
+						tbl.Append(lua.LNumber(-1))
+						tbl.Append(lua.LNumber(-1))
+						continue
+					}
+					tbl.Append(lua.LNumber(init + loc[i] + 1))
+					tbl.Append(lua.LNumber(init + loc[i+1]))
+				}
+				l.Push(tbl)
+				return 1
+			},
+			"findAll": func(l *lua.LState) int {
+				bs := checkBytes(l, 1)
+				re := cache.check(l, 2)
+				tbl := l.NewTable()
+				for _, m := range re.FindAll(bs, l.OptInt(3, -1)) {
+					tbl.Append(lua.LString(m))
+				}
+				l.Push(tbl)
+				return 1
+			},
+			"gsub": func(l *lua.LState) int {
+				bs := checkBytes(l, 1)
+				re := cache.check(l, 2)
+				if fn, ok := l.Get(3).(*lua.LFunction); ok {
+					l.Push(lua.LString(re.ReplaceAllFunc(bs, func(m []byte) []byte {
+						l.Push(fn)
+						l.Push(lua.LString(m))
+						l.Call(1, 1)
+						ret := l.Get(-1)
+						l.Pop(1)
+						return []byte(lua.LVAsString(ret))
+					})))
+					return 1
+				}
+				l.Push(lua.LString(re.ReplaceAll(bs, checkBytes(l, 3))))
+				return 1
+			},
+			"split": func(l *lua.LState) int {
+				re := cache.check(l, 2)
+				tbl := l.NewTable()
+				for _, s := range re.Split(l.CheckString(1), l.OptInt(3, -1)) {
+					tbl.Append(lua.LString(s))
+				}
+				l.Push(tbl)
+				return 1
+			},
+		})
+		l.Push(mod)
+		return 1
+	})
+}
+
+func regexpInit(l *lua.LState, n, length int) int {
+	init := l.OptInt(n, 1)
+	if init < 0 {
+		init = length + init + 1
+	}
+	if init < 1 {
+		init = 1
+	}
+	if init > length+1 {
+		init = length + 1
+	}
+	return init - 1
+}
+
+func pushSubmatches(l *lua.LState, bs []byte, loc []int) {
+	for i := 0; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			l.Push(lua.LNil)
+			continue
+		}
+		l.Push(lua.LString(bs[loc[i]:loc[i+1]]))
+	}
+}
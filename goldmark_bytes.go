@@ -0,0 +1,216 @@
+package dynamic
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+func exportGoldmarkBytes(l *lua.LState, opts options) {
+	l.PreloadModule("goldmark.bytes", func(l *lua.LState) int {
+		mod := l.NewTable()
+		l.SetFuncs(mod, map[string]lua.LGFunction{
+			"toString":       bytesToString,
+			"fromString":     bytesFromString,
+			"len":            bytesLen,
+			"byte":           bytesByte,
+			"sub":            bytesSub,
+			"find":           bytesFind,
+			"equal":          bytesEqual,
+			"hasPrefix":      bytesHasPrefix,
+			"hasSuffix":      bytesHasSuffix,
+			"trimSpace":      bytesTrimSpace,
+			"value":          bytesValue,
+			"peekLine":       bytesPeekLine,
+			"readLine":       bytesReadLine,
+			"isSpace":        bytesIsSpace,
+			"isPunct":        bytesIsPunct,
+			"isAlphaNumeric": bytesIsAlphaNumeric,
+		})
+		l.Push(mod)
+		return 1
+	})
+}
+
+// checkBytes returns the n-th argument as a read-only byte slice.
+// The argument must be a Lua string or a userdata that holds a []byte.
+func checkBytes(l *lua.LState, n int) []byte {
+	switch v := l.Get(n).(type) {
+	case lua.LString:
+		return util.StringToReadOnlyBytes(string(v))
+	case *lua.LUserData:
+		if bs, ok := v.Value.([]byte); ok {
+			return bs
+		}
+	}
+	l.TypeError(n, lua.LTString)
+	return nil
+}
+
+// luaRange converts Lua style 1-based inclusive indices(negative indices
+// are counted from the end) into Go style 0-based half-open indices.
+func luaRange(length, i, j int) (int, int) {
+	if i < 0 {
+		i = length + i + 1
+	}
+	if j < 0 {
+		j = length + j + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	if j > length {
+		j = length
+	}
+	if i > j {
+		return 0, 0
+	}
+	return i - 1, j
+}
+
+func bytesToString(l *lua.LState) int {
+	l.Push(lua.LString(checkBytes(l, 1)))
+	return 1
+}
+
+func bytesFromString(l *lua.LState) int {
+	l.Push(luar.New(l, []byte(l.CheckString(1))))
+	return 1
+}
+
+func bytesLen(l *lua.LState) int {
+	l.Push(lua.LNumber(len(checkBytes(l, 1))))
+	return 1
+}
+
+func bytesByte(l *lua.LState) int {
+	bs := checkBytes(l, 1)
+	i := l.OptInt(2, 1)
+	j := l.OptInt(3, i)
+	from, to := luaRange(len(bs), i, j)
+	for _, c := range bs[from:to] {
+		l.Push(lua.LNumber(c))
+	}
+	return to - from
+}
+
+func bytesSub(l *lua.LState) int {
+	bs := checkBytes(l, 1)
+	from, to := luaRange(len(bs), l.CheckInt(2), l.OptInt(3, -1))
+	l.Push(lua.LString(bs[from:to]))
+	return 1
+}
+
+func bytesFind(l *lua.LState) int {
+	bs := checkBytes(l, 1)
+	sep := checkBytes(l, 2)
+	init := l.OptInt(3, 1)
+	if init < 0 {
+		init = len(bs) + init + 1
+	}
+	if init < 1 {
+		init = 1
+	}
+	if init > len(bs)+1 {
+		l.Push(lua.LNil)
+		return 1
+	}
+	i := bytes.Index(bs[init-1:], sep)
+	if i < 0 {
+		l.Push(lua.LNil)
+		return 1
+	}
+	start := init + i
+	l.Push(lua.LNumber(start))
+	l.Push(lua.LNumber(start + len(sep) - 1))
+	return 2
+}
+
+func bytesEqual(l *lua.LState) int {
+	l.Push(lua.LBool(bytes.Equal(checkBytes(l, 1), checkBytes(l, 2))))
+	return 1
+}
+
+func bytesHasPrefix(l *lua.LState) int {
+	l.Push(lua.LBool(bytes.HasPrefix(checkBytes(l, 1), checkBytes(l, 2))))
+	return 1
+}
+
+func bytesHasSuffix(l *lua.LState) int {
+	l.Push(lua.LBool(bytes.HasSuffix(checkBytes(l, 1), checkBytes(l, 2))))
+	return 1
+}
+
+func bytesTrimSpace(l *lua.LState) int {
+	l.Push(lua.LString(util.TrimRightSpace(util.TrimLeftSpace(checkBytes(l, 1)))))
+	return 1
+}
+
+func bytesValue(l *lua.LState) int {
+	segment, ok := l.CheckUserData(1).Value.(text.Segment)
+	if !ok {
+		l.ArgError(1, "text.Segment expected")
+	}
+	l.Push(lua.LString(segment.Value(checkBytes(l, 2))))
+	return 1
+}
+
+func checkReader(l *lua.LState, n int) text.Reader {
+	reader, ok := l.CheckUserData(n).Value.(text.Reader)
+	if !ok {
+		l.ArgError(n, "text.Reader expected")
+	}
+	return reader
+}
+
+func bytesPeekLine(l *lua.LState) int {
+	line, segment := checkReader(l, 1).PeekLine()
+	if line == nil {
+		l.Push(lua.LNil)
+	} else {
+		l.Push(lua.LString(line))
+	}
+	l.Push(luar.New(l, segment))
+	return 2
+}
+
+func bytesReadLine(l *lua.LState) int {
+	reader := checkReader(l, 1)
+	line, segment := reader.PeekLine()
+	if line == nil {
+		l.Push(lua.LNil)
+	} else {
+		l.Push(lua.LString(line))
+		reader.AdvanceLine()
+	}
+	l.Push(luar.New(l, segment))
+	return 2
+}
+
+func checkByte(l *lua.LState, n int) byte {
+	if s, ok := l.Get(n).(lua.LString); ok {
+		if len(s) == 0 {
+			l.ArgError(n, "empty string")
+		}
+		return s[0]
+	}
+	return byte(l.CheckInt(n))
+}
+
+func bytesIsSpace(l *lua.LState) int {
+	l.Push(lua.LBool(util.IsSpace(checkByte(l, 1))))
+	return 1
+}
+
+func bytesIsPunct(l *lua.LState) int {
+	l.Push(lua.LBool(util.IsPunct(checkByte(l, 1))))
+	return 1
+}
+
+func bytesIsAlphaNumeric(l *lua.LState) int {
+	l.Push(lua.LBool(util.IsAlphaNumeric(checkByte(l, 1))))
+	return 1
+}
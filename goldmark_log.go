@@ -0,0 +1,118 @@
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// WithLogger is an option that sets a logger for the goldmark.log module.
+// This defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *dynamic) {
+		e.logger = logger
+	}
+}
+
+// WithPrintOutput is an option that sets a writer that print functions of
+// Lua, JavaScript and Starlark write to. This defaults to os.Stdout.
+// io.Discard silences print.
+func WithPrintOutput(w io.Writer) Option {
+	return func(e *dynamic) {
+		e.printOutput = w
+	}
+}
+
+// exportGoldmarkLog exports the goldmark.log module. Records are tagged with
+// a file name of the script that calls the function.
+func exportGoldmarkLog(l *lua.LState, config *RuntimeConfig) {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	l.PreloadModule("goldmark.log", func(l *lua.LState) int {
+		mod := l.NewTable()
+		l.SetFuncs(mod, map[string]lua.LGFunction{
+			"debug": luaLog(logger, slog.LevelDebug),
+			"info":  luaLog(logger, slog.LevelInfo),
+			"warn":  luaLog(logger, slog.LevelWarn),
+			"error": luaLog(logger, slog.LevelError),
+			"enabled": func(l *lua.LState) int {
+				level := luaLogLevel(l.CheckString(1))
+				l.Push(lua.LBool(logger.Enabled(context.Background(), level)))
+				return 1
+			},
+		})
+		l.Push(mod)
+		return 1
+	})
+	if config.PrintOutput != nil {
+		w := config.PrintOutput
+		l.SetGlobal("print", l.NewFunction(func(l *lua.LState) int {
+			values := make([]string, 0, l.GetTop())
+			for i := 1; i <= l.GetTop(); i++ {
+				values = append(values, l.ToStringMeta(l.Get(i)).String())
+			}
+			_, _ = fmt.Fprintln(w, strings.Join(values, "\t"))
+			return 0
+		}))
+	}
+}
+
+// luaLog returns a function that logs a message with key-value fields:
+//
+//	log.info("message", "key1", value1, "key2", value2)
+//	log.info("message", {key1 = value1, key2 = value2})
+func luaLog(logger *slog.Logger, level slog.Level) lua.LGFunction {
+	return func(l *lua.LState) int {
+		ctx := context.Background()
+		if !logger.Enabled(ctx, level) {
+			return 0
+		}
+		msg := l.CheckString(1)
+		attrs := []slog.Attr{slog.String("extension", luaCallerSource(l))}
+		if tbl, ok := l.Get(2).(*lua.LTable); ok && l.GetTop() == 2 {
+			fields := luaTableToMap(tbl)
+			keys := make([]string, 0, len(fields))
+			for key := range fields {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				attrs = append(attrs, slog.Any(key, fields[key]))
+			}
+		} else {
+			for i := 2; i <= l.GetTop(); i += 2 {
+				attrs = append(attrs, slog.Any(l.ToStringMeta(l.Get(i)).String(), luaToGo(l.Get(i+1))))
+			}
+		}
+		logger.LogAttrs(ctx, level, msg, attrs...)
+		return 0
+	}
+}
+
+// luaCallerSource returns a file name of the Lua function that calls the
+// current Go function.
+func luaCallerSource(l *lua.LState) string {
+	dbg, ok := l.GetStack(1)
+	if !ok {
+		return ""
+	}
+	if _, err := l.GetInfo("S", dbg, lua.LNil); err != nil {
+		return ""
+	}
+	return dbg.Source
+}
+
+func luaLogLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
@@ -0,0 +1,368 @@
+package dynamic
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// JavaScriptRuntime is a RuntimeFactory for JavaScript(ECMAScript 5.1+)
+// scripts(.js).
+//
+// Scripts are CommonJS modules: module.exports must be a function that
+// takes goldmark.Markdown and options. Go fields and methods are accessible
+// with names that the first letter is lower-cased like Lua.
+//
+// Modules that depend on Lua conventions(e.g. go.regexp, goldmark.bytes and
+// goldmark.log) are not available, and goldmark.text has only segment
+// constructors.
+var JavaScriptRuntime = NewRuntimeFactory([]string{".js"}, func(config *RuntimeConfig) Runtime {
+	return newJSRuntime(config)
+})
+
+type jsRuntime struct {
+	config  *RuntimeConfig
+	vm      *goja.Runtime
+	modules map[string]goja.Value
+	builtin map[string]*module
+}
+
+func newJSRuntime(config *RuntimeConfig) *jsRuntime {
+	r := &jsRuntime{
+		config:  config,
+		vm:      goja.New(),
+		modules: map[string]goja.Value{},
+		builtin: map[string]*module{},
+	}
+	r.vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
+	_ = r.vm.Set("print", r.print)
+	for _, m := range config.modules() {
+		r.builtin[m.name] = m
+	}
+	r.builtin["goldmark.text"] = &module{
+		name: "goldmark.text",
+		members: func() []moduleMember {
+			return []moduleMember{
+				{
+					name:  "newSegment",
+					value: text.NewSegment,
+				},
+				{
+					name:  "newSegmentPadding",
+					value: text.NewSegmentPadding,
+				},
+			}
+		},
+	}
+	return r
+}
+
+// print writes arguments separated by spaces like console.log.
+func (r *jsRuntime) print(call goja.FunctionCall) goja.Value {
+	values := make([]string, 0, len(call.Arguments))
+	for _, arg := range call.Arguments {
+		values = append(values, arg.String())
+	}
+	_, _ = fmt.Fprintln(r.config.printOutput(), strings.Join(values, " "))
+	return goja.Undefined()
+}
+
+func (r *jsRuntime) require(name string) goja.Value {
+	if v, ok := r.modules[name]; ok {
+		return v
+	}
+	var v goja.Value
+	if m, ok := r.builtin[name]; ok {
+		v = r.newModule(m)
+	} else {
+		file := path.Clean(strings.TrimPrefix(name, "./"))
+		if path.Ext(file) != ".js" {
+			file += ".js"
+		}
+		exports, err := r.loadFile(file)
+		if err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+		v = exports
+	}
+	r.modules[name] = v
+	return v
+}
+
+func (r *jsRuntime) newModule(m *module) goja.Value {
+	vm := r.vm
+	mod := vm.NewObject()
+	for _, member := range m.members() {
+		_ = mod.Set(member.name, member.value)
+	}
+	for _, c := range m.constructors {
+		c := c
+		_ = mod.Set(c.name, func(call goja.FunctionCall) goja.Value {
+			props, ok := call.Argument(0).(*goja.Object)
+			if !ok {
+				panic(vm.NewTypeError("%s: an object expected", c.name))
+			}
+			obj := &jsObject{r: r, name: c.object, obj: props, onError: r.config.OnError}
+			return vm.ToValue(c.fn(obj, r.config.OnError))
+		})
+	}
+	if extend, ok := jsModuleExtensions[m.name]; ok {
+		extend(mod)
+	}
+	return mod
+}
+
+// jsModuleExtensions are JavaScript specific members of common modules.
+var jsModuleExtensions = map[string]func(mod *goja.Object){
+	"goldmark.ast": func(mod *goja.Object) {
+		_ = mod.Set("toTable", func(node ast.Node, source []byte) map[string]any {
+			return NodeToMap(node, source)
+		})
+	},
+}
+
+// loadFile runs the given file as a CommonJS module and returns
+// module.exports.
+func (r *jsRuntime) loadFile(file string) (goja.Value, error) {
+	source, err := fs.ReadFile(r.config.FS, file)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := r.vm.RunScript(file, "(function(module, exports, require) {"+string(source)+"\n})")
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := goja.AssertFunction(wrapper)
+	if !ok {
+		return nil, fmt.Errorf("%s: failed to load a module", file)
+	}
+	module := r.vm.NewObject()
+	exports := r.vm.NewObject()
+	_ = module.Set("exports", exports)
+	if _, err := fn(goja.Undefined(), module, exports, r.vm.ToValue(r.require)); err != nil {
+		return nil, err
+	}
+	return module.Get("exports"), nil
+}
+
+func (r *jsRuntime) Load(m goldmark.Markdown, extension Extension) (map[string]Function, error) {
+	exports, err := r.loadFile(extension.File)
+	if err != nil {
+		return nil, err
+	}
+
+	// module.exports is function(m, opts) or an object that has
+	// extend(m, opts) and exported functions.
+	var functions map[string]Function
+	if _, ok := goja.AssertFunction(exports); !ok {
+		if obj, ok := exports.(*goja.Object); ok {
+			functions = map[string]Function{}
+			for _, key := range obj.Keys() {
+				if fn, ok := goja.AssertFunction(obj.Get(key)); ok && key != "extend" {
+					functions[key] = r.function(fn)
+				}
+			}
+			exports = obj.Get("extend")
+		}
+	}
+	fn, ok := goja.AssertFunction(exports)
+	if !ok {
+		return nil, fmt.Errorf("goldmark-dynamic javascript extension exports an invalid value: must be a function")
+	}
+	_, err = fn(goja.Undefined(), r.vm.ToValue(m), r.vm.ToValue(extension.Options))
+	return functions, err
+}
+
+func (r *jsRuntime) function(fn goja.Callable) Function {
+	return func(args ...any) ([]any, error) {
+		jsArgs := make([]goja.Value, 0, len(args))
+		for _, arg := range args {
+			jsArgs = append(jsArgs, r.vm.ToValue(arg))
+		}
+		v, err := fn(goja.Undefined(), jsArgs...)
+		if err != nil {
+			return nil, err
+		}
+		if goja.IsUndefined(v) {
+			return []any{}, nil
+		}
+		return []any{v.Export()}, nil
+	}
+}
+
+func (r *jsRuntime) Close() {
+	r.vm.Interrupt("closed")
+}
+
+// toValue converts a Go value into a JavaScript value.
+func (r *jsRuntime) toValue(v any) goja.Value {
+	if m, ok := v.(map[any]any); ok {
+		obj := r.vm.NewObject()
+		for key, value := range m {
+			_ = obj.Set(fmt.Sprint(key), value)
+		}
+		return obj
+	}
+	return r.vm.ToValue(v)
+}
+
+// toGo converts a JavaScript value into a Go value.
+// Functions are converted into scriptFunc and objects are converted into
+// nodeProps.
+func (r *jsRuntime) toGo(v goja.Value, this goja.Value) any {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	if fn, ok := goja.AssertFunction(v); ok {
+		return &jsFunc{r: r, fn: fn, this: this}
+	}
+	exported := v.Export()
+	if obj, ok := v.(*goja.Object); ok {
+		if _, ok := exported.(map[string]any); ok {
+			return &jsProps{obj: obj}
+		}
+	}
+	return exported
+}
+
+// jsFunc is a JavaScript function as a scriptFunc.
+// Functions return multiple values as an array.
+type jsFunc struct {
+	r    *jsRuntime
+	fn   goja.Callable
+	this goja.Value
+}
+
+func (f *jsFunc) call(nret int, args ...any) ([]any, error) {
+	jsArgs := make([]goja.Value, 0, len(args))
+	for _, arg := range args {
+		jsArgs = append(jsArgs, f.r.toValue(arg))
+	}
+	if f.this == nil {
+		f.this = goja.Undefined()
+	}
+	v, err := f.fn(f.this, jsArgs...)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]any, nret)
+	if nret == 0 {
+		return ret, nil
+	}
+	if nret == 1 {
+		ret[0] = f.r.toGo(v, nil)
+		return ret, nil
+	}
+	obj, ok := v.(*goja.Object)
+	if !ok || obj.ClassName() != "Array" {
+		ret[0] = f.r.toGo(v, nil)
+		return ret, nil
+	}
+	for i := 0; i < nret; i++ {
+		ret[i] = f.r.toGo(obj.Get(fmt.Sprint(i)), nil)
+	}
+	return ret, nil
+}
+
+// jsProps is a JavaScript object as nodeProps.
+type jsProps struct {
+	obj *goja.Object
+}
+
+func (p *jsProps) get(name string) any {
+	return p.obj.Get(name)
+}
+
+func (p *jsProps) toMap() map[string]any {
+	m, _ := p.obj.Export().(map[string]any)
+	return m
+}
+
+// jsObject is a JavaScript object as a scriptObject.
+type jsObject struct {
+	r       *jsRuntime
+	name    string
+	obj     *goja.Object
+	onError func(error)
+}
+
+func (o *jsObject) typeError(key, typ string) {
+	o.onError(fmt.Errorf("%s.%s: must be a %s", o.name, key, typ))
+}
+
+func (o *jsObject) get(key string) goja.Value {
+	v := o.obj.Get(key)
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	return v
+}
+
+func (o *jsObject) Func(key string, required bool) scriptFunc {
+	v := o.get(key)
+	if v == nil {
+		if required {
+			o.typeError(key, "function")
+		}
+		return nil
+	}
+	fn, ok := goja.AssertFunction(v)
+	if !ok {
+		o.typeError(key, "function")
+		return nil
+	}
+	return &jsFunc{r: o.r, fn: fn, this: o.obj}
+}
+
+func (o *jsObject) Bytes(key string) []byte {
+	v := o.get(key)
+	if v == nil {
+		return nil
+	}
+	s, ok := v.Export().(string)
+	if !ok {
+		o.typeError(key, "string")
+		return nil
+	}
+	return []byte(s)
+}
+
+func (o *jsObject) Bool(key string) bool {
+	v := o.get(key)
+	return v != nil && v.ToBoolean()
+}
+
+func (o *jsObject) Int(key string) int {
+	v := o.get(key)
+	if v == nil {
+		return 0
+	}
+	i, ok := toInt(v.Export())
+	if !ok {
+		o.typeError(key, "number")
+	}
+	return i
+}
+
+func (o *jsObject) Value(key string) any {
+	return o.r.toGo(o.get(key), o.obj)
+}
+
+func (o *jsObject) Props(key string) nodeProps {
+	v := o.get(key)
+	if v == nil {
+		return mapProps{}
+	}
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		o.typeError(key, "object")
+		return mapProps{}
+	}
+	return &jsProps{obj: obj}
+}
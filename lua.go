@@ -0,0 +1,542 @@
+package dynamic
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+// LuaRuntime is a RuntimeFactory for Lua scripts(.lua).
+//
+// Readers(text.Reader), contexts(parser.Context) and writers(util.BufWriter)
+// passed to Lua hooks are userdata that are reused and rebound to new values
+// for each call to reduce allocations. Scripts must not retain them over
+// calls: a reader stored in a hook refers to a reader of the next call.
+// Copy values(e.g. lines and segments) instead.
+var LuaRuntime = NewRuntimeFactory([]string{".lua"}, func(config *RuntimeConfig) Runtime {
+	return newLuaRuntime(config)
+})
+
+type luaRuntime struct {
+	config    *RuntimeConfig
+	l         *lua.LState
+	args      *luaArgs
+	lineHooks []luaLineHook
+}
+
+func newLuaRuntime(config *RuntimeConfig) *luaRuntime {
+	r := &luaRuntime{
+		config: config,
+		l:      lua.NewState(),
+	}
+	l := r.l
+	r.args = newLuaArgs(l)
+	luar.GetConfig(l).MethodNames = luaMethodNames
+	for _, m := range config.modules() {
+		r.preloadModule(m)
+	}
+	exportGoRegexp(l, r)
+	exportGoldmarkBytes(l, r)
+	exportGoldmarkText(l, r)
+	exportGoldmarkLog(l, config)
+	if config.LuaDebugger != nil {
+		r.lineHooks = append(r.lineHooks, config.LuaDebugger)
+	}
+	if config.LuaCoverage != nil {
+		r.lineHooks = append(r.lineHooks, config.LuaCoverage)
+	}
+	if len(r.lineHooks) != 0 {
+		exportLuaLineHooks(l, r.lineHooks)
+	}
+	for name, loader := range config.LuaModules {
+		l.PreloadModule(name, loader)
+	}
+
+	loaders, _ := l.GetField(l.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable)
+	loaders.Append(l.NewFunction(r.fsLoader))
+
+	// TODO: support io.* functions?
+
+	return r
+}
+
+func (r *luaRuntime) OnError() func(error) {
+	return r.config.OnError
+}
+
+func (r *luaRuntime) preloadModule(m *module) {
+	r.l.PreloadModule(m.name, func(l *lua.LState) int {
+		mod := l.NewTable()
+		for _, member := range m.members() {
+			mod.RawSetString(member.name, luar.New(l, member.value))
+		}
+		for _, c := range m.constructors {
+			c := c
+			mod.RawSetString(c.name, l.NewFunction(func(l *lua.LState) int {
+				obj := newPropTable(r.args, c.object, l.CheckTable(1), r.config.OnError)
+				l.Push(luar.New(l, c.fn(obj, r.config.OnError)))
+				return 1
+			}))
+		}
+		if extend, ok := luaModuleExtensions[m.name]; ok {
+			extend(r, l, mod)
+		}
+		l.Push(mod)
+		return 1
+	})
+}
+
+// luaModuleExtensions are Lua specific members of common modules.
+var luaModuleExtensions = map[string]func(r *luaRuntime, l *lua.LState, mod *lua.LTable){
+	"goldmark.dynamic": func(r *luaRuntime, l *lua.LState, mod *lua.LTable) {
+		mod.RawSetString("vars", l.NewFunction(luaDocumentVars))
+	},
+	"goldmark.meta":           exportGoldmarkMeta,
+	"goldmark.parser.context": exportGoldmarkParserContext,
+	"go.bytes": func(r *luaRuntime, l *lua.LState, mod *lua.LTable) {
+		mod.RawSetString("Buffer", luar.NewType(l, bytes.Buffer{}))
+		mod.RawSetString("Reader", luar.NewType(l, bytes.Reader{}))
+	},
+	"goldmark.ast": func(r *luaRuntime, l *lua.LState, mod *lua.LTable) {
+		mod.RawSetString("walk", l.NewFunction(luaWalk(r.args)))
+		mod.RawSetString("toTable", l.NewFunction(func(l *lua.LState) int {
+			node, ok := l.CheckUserData(1).Value.(ast.Node)
+			if !ok {
+				l.ArgError(1, "ast.Node expected")
+			}
+			var source []byte
+			switch v := l.Get(2).(type) {
+			case lua.LString:
+				source = []byte(v)
+			case *lua.LUserData:
+				source, _ = v.Value.([]byte)
+			}
+			l.Push(goToLua(l, NodeToMap(node, source)))
+			return 1
+		}))
+	},
+}
+
+func exportGoldmarkText(l *lua.LState, opts options) {
+	l.PreloadModule("goldmark.text", func(l *lua.LState) int {
+		mod := l.NewTable()
+		mod.RawSetString("FindClosureOptions", luar.NewType(l, text.FindClosureOptions{}))
+
+		mt := l.NewTypeMetatable("Segment")
+		mod.RawSetString("Segment", mt)
+		l.SetField(mt, "new", l.NewFunction(func(l *lua.LState) int {
+			n := l.GetTop()
+			ud := l.NewUserData()
+			l.SetMetatable(ud, l.GetTypeMetatable("Segment"))
+			start := l.CheckNumber(1)
+			stop := l.CheckNumber(2)
+			if n == 2 {
+				ud.Value = text.NewSegment(int(start), int(stop))
+			}
+			if n == 3 {
+				padding := l.CheckNumber(3)
+				ud.Value = text.NewSegmentPadding(int(start), int(stop), int(padding))
+			}
+			l.Push(ud)
+			return 1
+		}))
+		l.SetField(mt, "__index", l.NewFunction(func(l *lua.LState) int {
+			ud := l.CheckUserData(1)
+			prop := l.CheckString(2)
+			switch prop {
+			case "start":
+				l.Push(lua.LNumber(ud.Value.(text.Segment).Start))
+			case "stop":
+				l.Push(lua.LNumber(ud.Value.(text.Segment).Stop))
+			case "padding":
+				l.Push(lua.LNumber(ud.Value.(text.Segment).Padding))
+			default:
+				l.Push(lua.LNil)
+			}
+			return 1
+		}))
+		l.Push(mod)
+		return 1
+	})
+}
+
+func (r *luaRuntime) findFile(l *lua.LState, name, pname string) (string, string) {
+	name = strings.Replace(name, ".", string(os.PathSeparator), -1)
+	lv := l.GetField(l.GetField(l.Get(lua.EnvironIndex), "package"), pname)
+	path, ok := lv.(lua.LString)
+	if !ok {
+		l.RaiseError("package.%s must be a string", pname)
+	}
+	messages := []string{}
+	for _, pattern := range strings.Split(string(path), ";") {
+		luapath := strings.Replace(pattern, "?", name, -1)
+		_, err := r.config.FS.Stat(luapath)
+		if err == nil {
+			return luapath, ""
+		}
+		messages = append(messages, err.Error())
+	}
+	return "", strings.Join(messages, "\n\t")
+}
+
+func (r *luaRuntime) fsLoader(l *lua.LState) int {
+	name := l.CheckString(1)
+	path, msg := r.findFile(l, name, "path")
+	if len(path) == 0 {
+		l.Push(lua.LString(msg))
+		return 1
+	}
+	fn, err1 := loadLuaFileFS(l, r.config.FS, path, r.lineHooks)
+	if err1 != nil {
+		l.RaiseError(err1.Error())
+	}
+	l.Push(fn)
+	return 1
+}
+
+func (r *luaRuntime) Load(m goldmark.Markdown, extension Extension) (map[string]Function, error) {
+	l := r.l
+	fn, err := loadLuaFileFS(l, r.config.FS, extension.File, r.lineHooks)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.CallByParam(lua.P{
+		Fn:      fn,
+		NRet:    1,
+		Protect: true,
+	}); err != nil {
+		return nil, err
+	}
+	ret := l.Get(-1)
+	l.Pop(1)
+
+	// an extension returns function(m, opts) or a table that has
+	// extend(m, opts) and exported functions.
+	var exports map[string]Function
+	if tbl, ok := ret.(*lua.LTable); ok {
+		exports = map[string]Function{}
+		tbl.ForEach(func(key, value lua.LValue) {
+			if fn, ok := value.(*lua.LFunction); ok && key.String() != "extend" {
+				exports[key.String()] = r.function(fn)
+			}
+		})
+		ret = l.GetField(tbl, "extend")
+	}
+	if _, err := mustLValue(ret, lua.LTFunction); err != nil {
+		return nil, fmt.Errorf("goldmark-dynamic lua extension returns an invalid value: %w", err)
+	}
+
+	return exports, l.CallByParam(lua.P{
+		Fn:      ret.(*lua.LFunction),
+		NRet:    1,
+		Protect: true,
+	}, luar.New(l, m), luar.New(l, extension.Options))
+}
+
+func (r *luaRuntime) function(fn *lua.LFunction) Function {
+	return func(args ...any) ([]any, error) {
+		l := r.l
+		top := l.GetTop()
+		defer l.SetTop(top)
+		l.Push(fn)
+		for _, arg := range args {
+			l.Push(goToLua(l, arg))
+		}
+		if err := l.PCall(len(args), lua.MultRet, nil); err != nil {
+			return nil, err
+		}
+		ret := make([]any, 0, l.GetTop()-top)
+		for i := top + 1; i <= l.GetTop(); i++ {
+			ret = append(ret, luaToGo(l.Get(i)))
+		}
+		return ret, nil
+	}
+}
+
+func (r *luaRuntime) Close() {
+	r.l.Close()
+}
+
+// luaFunc is a Lua function as a scriptFunc.
+type luaFunc struct {
+	l    *lua.LState
+	fn   *lua.LFunction
+	args *luaArgs
+}
+
+func (f *luaFunc) call(nret int, args ...any) ([]any, error) {
+	l := f.l
+	largs := make([]lua.LValue, 0, len(args))
+	for _, arg := range args {
+		largs = append(largs, f.args.value(arg))
+	}
+	if err := l.CallByParam(lua.P{
+		Fn:      f.fn,
+		NRet:    nret,
+		Protect: true,
+	}, largs...); err != nil {
+		return nil, err
+	}
+	ret := make([]any, nret)
+	for i := 0; i < nret; i++ {
+		ret[i] = luaResult(f.args, l.Get(i-nret))
+	}
+	l.Pop(nret)
+	return ret, nil
+}
+
+// luaResult converts a value returned from Lua functions into a Go value.
+// Tables are converted into nodeProps.
+func luaResult(args *luaArgs, lv lua.LValue) any {
+	switch v := lv.(type) {
+	case *lua.LFunction:
+		return &luaFunc{l: args.l, fn: v, args: args}
+	case *lua.LTable:
+		return &luaProps{l: args.l, table: v}
+	case lua.LNumber:
+		return float64(v)
+	}
+	return luaToGo(lv)
+}
+
+// luaProps is a Lua table as nodeProps.
+type luaProps struct {
+	l     *lua.LState
+	table *lua.LTable
+}
+
+func (p *luaProps) get(name string) any {
+	return p.l.GetField(p.table, name)
+}
+
+func (p *luaProps) toMap() map[string]any {
+	return luaTableToMap(p.table)
+}
+
+// loadLuaFileFS loads a Lua file. If hooks are given, the file is
+// instrumented with line hooks.
+func loadLuaFileFS(l *lua.LState, f fs.FS, path string, hooks []luaLineHook) (*lua.LFunction, error) {
+	file, err := f.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	c, err := reader.ReadByte()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if c == byte('#') {
+		_, _, err = reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err != io.EOF {
+		err = reader.UnreadByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(hooks) != 0 {
+		return loadInstrumentedLua(l, reader, path, hooks)
+	}
+	return l.Load(reader, path)
+}
+
+type propTable struct {
+	l       *lua.LState
+	args    *luaArgs
+	Name    string
+	Table   *lua.LTable
+	onError func(error)
+}
+
+func newPropTable(args *luaArgs, name string, table *lua.LTable, onError func(error)) *propTable {
+	return &propTable{
+		l:       args.l,
+		args:    args,
+		Name:    name,
+		Table:   table,
+		onError: onError,
+	}
+}
+
+func (t *propTable) Get(key string, types ...lua.LValueType) lua.LValue {
+	lv, err := mustLValue(t.l.GetField(t.Table, key), types...)
+	if err != nil {
+		t.onError(fmt.Errorf("%s.%s: %w", t.Name, key, err))
+	}
+	return lv
+}
+
+func (t *propTable) Bool(key string) bool {
+	lv := t.l.GetField(t.Table, key)
+	return !lua.LVIsFalse(lv)
+}
+
+func (t *propTable) Bytes(key string) []byte {
+	lv := t.Get(key, lua.LTString)
+	var bs []byte
+	if lv != lua.LNil {
+		bs = []byte(string(lv.(lua.LString)))
+	}
+	return bs
+}
+
+func (t *propTable) Int(key string) int {
+	lv := t.Get(key, lua.LTNumber)
+	if lv == lua.LNil {
+		return 0
+	}
+	return int(lv.(lua.LNumber))
+}
+
+func (t *propTable) Func(key string, required bool) scriptFunc {
+	types := []lua.LValueType{lua.LTFunction}
+	if !required {
+		types = append(types, lua.LTNil)
+	}
+	fn, ok := t.Get(key, types...).(*lua.LFunction)
+	if !ok {
+		return nil
+	}
+	return &luaFunc{l: t.l, fn: fn, args: t.args}
+}
+
+func (t *propTable) Value(key string) any {
+	return luaResult(t.args, t.l.GetField(t.Table, key))
+}
+
+func (t *propTable) Props(key string) nodeProps {
+	tbl, ok := t.Get(key, lua.LTTable, lua.LTNil).(*lua.LTable)
+	if !ok {
+		return mapProps{}
+	}
+	return &luaProps{l: t.l, table: tbl}
+}
+
+func mustLValue(v lua.LValue, types ...lua.LValueType) (lua.LValue, error) {
+	for _, typ := range types {
+		if v.Type() == typ {
+			return v, nil
+		}
+	}
+	var buf []string
+	for _, typ := range types {
+		buf = append(buf, typ.String())
+	}
+	return lua.LNil, fmt.Errorf("must be a %s", strings.Join(buf, " or "))
+}
+
+// luaToGo converts a Lua value into a Go value. Tables that refer to
+// themselves(e.g. t.self = t) are converted into nil at the second visit.
+func luaToGo(lv lua.LValue) any {
+	return luaToGoVisited(lv, map[*lua.LTable]bool{})
+}
+
+func luaToGoVisited(lv lua.LValue, visited map[*lua.LTable]bool) any {
+	switch v := lv.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int(f)
+		}
+		return f
+	case *lua.LTable:
+		if visited[v] {
+			return nil
+		}
+		visited[v] = true
+		defer delete(visited, v)
+		if n := v.MaxN(); n != 0 && n == v.Len() && isSequence(v, n) {
+			ret := make([]any, 0, n)
+			for i := 1; i <= n; i++ {
+				ret = append(ret, luaToGoVisited(v.RawGetInt(i), visited))
+			}
+			return ret
+		}
+		return luaTableToMapVisited(v, visited)
+	case *lua.LUserData:
+		return v.Value
+	}
+	return nil
+}
+
+func luaTableToMap(t *lua.LTable) map[string]any {
+	return luaTableToMapVisited(t, map[*lua.LTable]bool{t: true})
+}
+
+func luaTableToMapVisited(t *lua.LTable, visited map[*lua.LTable]bool) map[string]any {
+	ret := map[string]any{}
+	t.ForEach(func(key, value lua.LValue) {
+		ret[key.String()] = luaToGoVisited(value, visited)
+	})
+	return ret
+}
+
+func isSequence(t *lua.LTable, n int) bool {
+	size := 0
+	t.ForEach(func(lua.LValue, lua.LValue) {
+		size++
+	})
+	return size == n
+}
+
+func goToLua(l *lua.LState, value any) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case lua.LValue:
+		return v
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case []any:
+		tbl := l.CreateTable(len(v), 0)
+		for _, e := range v {
+			tbl.Append(goToLua(l, e))
+		}
+		return tbl
+	case map[string]any:
+		tbl := l.CreateTable(0, len(v))
+		for k, e := range v {
+			tbl.RawSetString(k, goToLua(l, e))
+		}
+		return tbl
+	case map[any]any:
+		tbl := l.CreateTable(0, len(v))
+		for k, e := range v {
+			tbl.RawSet(goToLua(l, k), goToLua(l, e))
+		}
+		return tbl
+	}
+	return luar.New(l, value)
+}
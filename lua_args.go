@@ -0,0 +1,153 @@
+package dynamic
+
+import (
+	"reflect"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+// luaArgs converts Go values that are passed to Lua functions into Lua
+// values.
+//
+// Parsers, transformers and renderers live as long as a goldmark.Markdown, so
+// their userdata are cached. Readers, contexts and writers are passed to Lua
+// functions for every trigger and every line, so userdata of them are reused
+// and rebound to new values for each call. Scripts should not retain them
+// over calls. Readers are wrapped by luaReader.
+type luaArgs struct {
+	l       *lua.LState
+	pinned  map[any]lua.LValue
+	rebound map[reflect.Type]*lua.LUserData
+	readers map[reflect.Type]*lua.LUserData
+	regexps *regexpCache
+}
+
+func newLuaArgs(l *lua.LState) *luaArgs {
+	return &luaArgs{
+		l:       l,
+		pinned:  map[any]lua.LValue{},
+		rebound: map[reflect.Type]*lua.LUserData{},
+		readers: map[reflect.Type]*lua.LUserData{},
+		regexps: &regexpCache{regexps: map[string]*regexp.Regexp{}},
+	}
+}
+
+func (a *luaArgs) value(v any) lua.LValue {
+	switch arg := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(arg)
+	case map[any]any:
+		return goToLua(a.l, arg)
+	case renderer.NodeRendererFuncRegisterer:
+		return luar.New(a.l, &luaRegisterer{reg: arg, args: a})
+	case parser.InlineParser, parser.BlockParser, parser.ASTTransformer,
+		parser.ParagraphTransformer, parser.DelimiterProcessor, renderer.NodeRenderer:
+		if reflect.TypeOf(v).Kind() != reflect.Ptr {
+			break
+		}
+		lv, ok := a.pinned[v]
+		if !ok {
+			lv = luar.New(a.l, v)
+			a.pinned[v] = lv
+		}
+		return lv
+	case *luaReader:
+		return luar.New(a.l, arg)
+	case text.Reader:
+		typ := reflect.TypeOf(v)
+		if ud, ok := a.readers[typ]; ok {
+			ud.Value.(*luaReader).Reader = arg
+			return ud
+		}
+		ud := luar.New(a.l, &luaReader{Reader: arg, regexps: a.regexps}).(*lua.LUserData)
+		a.readers[typ] = ud
+		return ud
+	case parser.Context, util.BufWriter:
+		typ := reflect.TypeOf(v)
+		if ud, ok := a.rebound[typ]; ok {
+			ud.Value = v
+			return ud
+		}
+		lv := luar.New(a.l, v)
+		if ud, ok := lv.(*lua.LUserData); ok {
+			a.rebound[typ] = ud
+		}
+		return lv
+	}
+	return luar.New(a.l, v)
+}
+
+// luaRegisterer is a renderer.NodeRendererFuncRegisterer for Lua.
+// Lua functions are called directly instead of Go functions converted by
+// gopher-luar that create a new thread for each call.
+type luaRegisterer struct {
+	reg  renderer.NodeRendererFuncRegisterer
+	args *luaArgs
+}
+
+// Register registers a Lua function or a Go function that is a
+// renderer.NodeRendererFunc(e.g. a function of a module added by
+// WithGoModule).
+func (r *luaRegisterer) Register(kind ast.NodeKind, fn lua.LValue) {
+	switch v := fn.(type) {
+	case *lua.LFunction:
+		f := &luaFunc{l: r.args.l, fn: v, args: r.args}
+		r.reg.Register(kind, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+			return f.walkStatus(f.call(2, w, source, n, entering))
+		})
+		return
+	case *lua.LUserData:
+		switch f := v.Value.(type) {
+		case renderer.NodeRendererFunc:
+			r.reg.Register(kind, f)
+			return
+		case func(util.BufWriter, []byte, ast.Node, bool) (ast.WalkStatus, error):
+			r.reg.Register(kind, f)
+			return
+		}
+	}
+	r.args.l.ArgError(2, "renderer.NodeRendererFunc expected")
+}
+
+// luaWalk is ast.Walk for Lua. The walker is called directly like
+// luaRegisterer.
+func luaWalk(args *luaArgs) lua.LGFunction {
+	return func(l *lua.LState) int {
+		node, ok := l.CheckUserData(1).Value.(ast.Node)
+		if !ok {
+			l.ArgError(1, "ast.Node expected")
+		}
+		f := &luaFunc{l: l, fn: l.CheckFunction(2), args: args}
+		err := ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			return f.walkStatus(f.call(2, n, entering))
+		})
+		if err != nil {
+			l.Push(luar.New(l, err))
+			return 1
+		}
+		l.Push(lua.LNil)
+		return 1
+	}
+}
+
+// walkStatus converts results of Lua functions that return ast.WalkStatus
+// and an error.
+func (f *luaFunc) walkStatus(ret []any, err error) (ast.WalkStatus, error) {
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	status, _ := toInt(ret[0])
+	if e, ok := ret[1].(error); ok {
+		err = e
+	}
+	return ast.WalkStatus(status), err
+}
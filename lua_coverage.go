@@ -0,0 +1,109 @@
+package dynamic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaCoverage records which lines of Lua extensions are executed.
+// Lua files that are loaded as extensions or required by extensions are
+// recorded. A LuaCoverage can be shared by multiple extenders(e.g. all tests
+// of a package) and is safe for concurrent use.
+//
+// Lua files are instrumented like [LuaDebugger], so extensions run slower
+// while coverage is recorded.
+type LuaCoverage struct {
+	mu    sync.Mutex
+	files map[string]map[int]int64
+}
+
+// NewLuaCoverage returns a new LuaCoverage.
+func NewLuaCoverage() *LuaCoverage {
+	return &LuaCoverage{
+		files: map[string]map[int]int64{},
+	}
+}
+
+// WithLuaCoverage is an option that records coverage of Lua extensions into
+// the c.
+func WithLuaCoverage(c *LuaCoverage) Option {
+	return func(e *dynamic) {
+		e.luaCoverage = c
+	}
+}
+
+func (c *LuaCoverage) luaLoad(file string, lines []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hits, ok := c.files[file]
+	if !ok {
+		hits = map[int]int64{}
+		c.files[file] = hits
+	}
+	for _, line := range lines {
+		if _, ok := hits[line]; !ok {
+			hits[line] = 0
+		}
+	}
+}
+
+func (c *LuaCoverage) luaLine(l *lua.LState, file string, line int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[file][line]++
+}
+
+// Percent returns a percentage of executed lines of all files.
+func (c *LuaCoverage) Percent() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found, hit := 0, 0
+	for _, hits := range c.files {
+		for _, n := range hits {
+			found++
+			if n != 0 {
+				hit++
+			}
+		}
+	}
+	if found == 0 {
+		return 0
+	}
+	return float64(hit) / float64(found) * 100
+}
+
+// WriteLcov writes coverage as an lcov tracefile.
+func (c *LuaCoverage) WriteLcov(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := make([]string, 0, len(c.files))
+	for file := range c.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	bw := bufio.NewWriter(w)
+	for _, file := range files {
+		hits := c.files[file]
+		lines := make([]int, 0, len(hits))
+		for line := range hits {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", file)
+		hit := 0
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, hits[line])
+			if hits[line] != 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
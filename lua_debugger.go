@@ -0,0 +1,361 @@
+package dynamic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+type luaStepMode int
+
+const (
+	luaStepNone luaStepMode = iota
+	luaStepIn
+	luaStepOver
+	luaStepOut
+)
+
+// LuaDebugger is a debugger for Lua extensions. LuaDebugger supports
+// breakpoints by file:line, stepping and variable inspection.
+//
+// LuaDebugger stops before a statement is executed when the statement hits
+// a breakpoint, a step finishes or [LuaDebugger.Pause] is called. While
+// stopped, LuaDebugger writes
+//
+//	stopped <reason> <file>:<line>
+//
+// and reads commands line by line. Each command responds with lines
+// followed by 'ok' or 'error <message>'.
+//
+//	break <file>:<line>    sets a breakpoint
+//	clear <file>:<line>    clears a breakpoint
+//	breakpoints            lists breakpoints
+//	locals                 lists local variables of the current function
+//	print <name>[.<field>] prints a local, an upvalue or a global variable
+//	where                  prints a stack trace
+//	step                   steps into functions
+//	next                   steps over functions
+//	finish                 steps out of the current function
+//	continue               continues the execution
+//
+// When commands reach EOF, LuaDebugger detaches: breakpoints are cleared and
+// the execution continues.
+//
+// Lua files are instrumented to call the debugger before each statement
+// because gopher-lua does not have hooks, so extensions run slower while
+// a debugger is set.
+type LuaDebugger struct {
+	mu          sync.Mutex
+	in          *bufio.Scanner
+	out         io.Writer
+	breakpoints map[string]map[int]bool
+	step        luaStepMode
+	depth       int
+	detached    bool
+}
+
+// NewLuaDebugger returns a new LuaDebugger that reads commands from the r
+// and writes responses to the w(e.g. a net.Conn).
+func NewLuaDebugger(r io.Reader, w io.Writer) *LuaDebugger {
+	return &LuaDebugger{
+		in:          bufio.NewScanner(r),
+		out:         w,
+		breakpoints: map[string]map[int]bool{},
+	}
+}
+
+// WithLuaDebugger is an option that sets a [LuaDebugger].
+func WithLuaDebugger(d *LuaDebugger) Option {
+	return func(e *dynamic) {
+		e.luaDebugger = d
+	}
+}
+
+// SetBreakpoint sets a breakpoint. The file is a path of the Lua file, or a
+// path that ends with the path(e.g. an absolute path).
+func (d *LuaDebugger) SetBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.breakpoints[file]; !ok {
+		d.breakpoints[file] = map[int]bool{}
+	}
+	d.breakpoints[file][line] = true
+}
+
+// ClearBreakpoint clears a breakpoint.
+func (d *LuaDebugger) ClearBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints[file], line)
+	if len(d.breakpoints[file]) == 0 {
+		delete(d.breakpoints, file)
+	}
+}
+
+// Pause stops the execution before the next statement.
+// Pause can be called from other goroutines.
+func (d *LuaDebugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.step = luaStepIn
+}
+
+func (d *LuaDebugger) luaLoad(file string, lines []int) {}
+
+func (d *LuaDebugger) luaLine(l *lua.LState, file string, line int) {
+	d.mu.Lock()
+	reason := ""
+	if d.hitBreakpoint(file, line) {
+		reason = "breakpoint"
+	} else if d.step != luaStepNone {
+		depth := luaStackDepth(l)
+		if d.step == luaStepIn ||
+			(d.step == luaStepOver && depth <= d.depth) ||
+			(d.step == luaStepOut && depth < d.depth) {
+			reason = "step"
+		}
+	}
+	d.mu.Unlock()
+	if len(reason) != 0 {
+		d.stop(l, reason, file, line)
+	}
+}
+
+func (d *LuaDebugger) hitBreakpoint(file string, line int) bool {
+	for f, lines := range d.breakpoints {
+		if lines[line] && (f == file || strings.HasSuffix(f, "/"+file) || strings.HasSuffix(file, "/"+f)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stop reads commands until a command resumes the execution.
+func (d *LuaDebugger) stop(l *lua.LState, reason, file string, line int) {
+	d.mu.Lock()
+	d.step = luaStepNone
+	detached := d.detached
+	d.mu.Unlock()
+	if detached {
+		return
+	}
+	d.printf("stopped %s %s:%d\n", reason, file, line)
+	for d.in.Scan() {
+		command, arg, _ := strings.Cut(strings.TrimSpace(d.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "step", "s":
+			d.resume(l, luaStepIn)
+			return
+		case "next", "n":
+			d.resume(l, luaStepOver)
+			return
+		case "finish", "f":
+			d.resume(l, luaStepOut)
+			return
+		case "continue", "c":
+			d.resume(l, luaStepNone)
+			return
+		case "break", "b", "clear":
+			file, line, ok := parseLuaLocation(arg)
+			if !ok {
+				d.printf("error invalid location: %s\n", arg)
+				continue
+			}
+			if command == "clear" {
+				d.ClearBreakpoint(file, line)
+			} else {
+				d.SetBreakpoint(file, line)
+			}
+		case "breakpoints":
+			for _, bp := range d.breakpointList() {
+				d.printf("%s\n", bp)
+			}
+		case "locals":
+			for _, v := range luaLocals(l) {
+				d.printf("%s = %s\n", v.name, formatLuaValue(l, v.value))
+			}
+		case "print", "p":
+			v, ok := lookupLuaVariable(l, arg)
+			if !ok {
+				d.printf("error undefined variable: %s\n", arg)
+				continue
+			}
+			d.printf("%s = %s\n", arg, formatLuaValue(l, v))
+		case "where", "bt":
+			for _, frame := range luaStackTrace(l) {
+				d.printf("%s\n", frame)
+			}
+		default:
+			d.printf("error unknown command: %s\n", command)
+			continue
+		}
+		d.printf("ok\n")
+	}
+	// commands reach EOF
+	d.mu.Lock()
+	d.detached = true
+	d.breakpoints = map[string]map[int]bool{}
+	d.mu.Unlock()
+}
+
+func (d *LuaDebugger) resume(l *lua.LState, mode luaStepMode) {
+	d.mu.Lock()
+	d.step = mode
+	d.depth = luaStackDepth(l)
+	d.mu.Unlock()
+	d.printf("ok\n")
+}
+
+func (d *LuaDebugger) breakpointList() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ret := []string{}
+	for file, lines := range d.breakpoints {
+		for line := range lines {
+			ret = append(ret, fmt.Sprintf("%s:%d", file, line))
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (d *LuaDebugger) printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(d.out, format, args...)
+}
+
+func parseLuaLocation(s string) (string, int, bool) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 1 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return s[:i], line, true
+}
+
+// luaStackDepth returns a number of frames on the stack.
+func luaStackDepth(l *lua.LState) int {
+	depth := 0
+	for {
+		if _, ok := l.GetStack(depth); !ok {
+			return depth
+		}
+		depth++
+	}
+}
+
+type luaVariable struct {
+	name  string
+	value lua.LValue
+}
+
+// luaLocals returns active local variables of a function that calls the
+// line hook. Internal variables like '(for index)' are skipped.
+func luaLocals(l *lua.LState) []luaVariable {
+	dbg, ok := l.GetStack(1)
+	if !ok {
+		return nil
+	}
+	ret := []luaVariable{}
+	for i := 1; ; i++ {
+		name, value := l.GetLocal(dbg, i)
+		if len(name) == 0 {
+			break
+		}
+		if strings.HasPrefix(name, "(") {
+			continue
+		}
+		ret = append(ret, luaVariable{name: name, value: value})
+	}
+	return ret
+}
+
+func lookupLuaVariable(l *lua.LState, path string) (lua.LValue, bool) {
+	names := strings.Split(path, ".")
+	var value lua.LValue = lua.LNil
+	found := false
+	for _, v := range luaLocals(l) {
+		if v.name == names[0] {
+			value, found = v.value, true // later locals shadow earlier locals
+		}
+	}
+	if !found {
+		if dbg, ok := l.GetStack(1); ok {
+			if fn, err := l.GetInfo("f", dbg, lua.LNil); err == nil {
+				if f, ok := fn.(*lua.LFunction); ok {
+					for i := 1; ; i++ {
+						name, v := l.GetUpvalue(f, i)
+						if len(name) == 0 {
+							break
+						}
+						if name == names[0] {
+							value, found = v, true
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+	if !found {
+		value = l.GetGlobal(names[0])
+		found = value != lua.LNil
+	}
+	for _, name := range names[1:] {
+		if !found {
+			break
+		}
+		switch value.(type) {
+		case *lua.LTable, *lua.LUserData:
+			value = l.GetField(value, name)
+		default:
+			return lua.LNil, false
+		}
+	}
+	return value, found
+}
+
+func formatLuaValue(l *lua.LState, v lua.LValue) string {
+	if s, ok := v.(lua.LString); ok {
+		return strconv.Quote(string(s))
+	}
+	if tbl, ok := v.(*lua.LTable); ok {
+		fields := []string{}
+		tbl.ForEach(func(key, value lua.LValue) {
+			if len(fields) < 10 {
+				fields = append(fields, fmt.Sprintf("%s=%s", key.String(), l.ToStringMeta(value).String()))
+			}
+		})
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return fmt.Sprintf("%s (%s)", l.ToStringMeta(v).String(), v.Type().String())
+}
+
+// luaStackTrace returns Lua frames of the stack.
+func luaStackTrace(l *lua.LState) []string {
+	ret := []string{}
+	for level := 1; ; level++ {
+		dbg, ok := l.GetStack(level)
+		if !ok {
+			break
+		}
+		if _, err := l.GetInfo("Sln", dbg, lua.LNil); err != nil || dbg.What == "G" {
+			continue
+		}
+		name := "main chunk"
+		if dbg.LineDefined != 0 {
+			name = fmt.Sprintf("function <%s:%d>", dbg.Source, dbg.LineDefined)
+		}
+		ret = append(ret, fmt.Sprintf("%s:%d in %s", dbg.Source, dbg.CurrentLine, name))
+	}
+	return ret
+}
@@ -0,0 +1,157 @@
+package dynamic
+
+import (
+	"io"
+	"sort"
+	"strconv"
+
+	lua "github.com/yuin/gopher-lua"
+	luaast "github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// gopher-lua does not have hooks like debug.sethook. Lua files are
+// instrumented instead: a call of luaLineHookName is inserted before each
+// statement when line hooks(a debugger or coverage) are enabled.
+const luaLineHookName = "__goldmark_dynamic_line"
+
+// luaLineHook is called before each statement of instrumented Lua files
+// are executed.
+type luaLineHook interface {
+	// luaLoad is called when a Lua file is loaded with lines that have
+	// statements.
+	luaLoad(file string, lines []int)
+
+	luaLine(l *lua.LState, file string, line int)
+}
+
+// exportLuaLineHooks defines a global function that calls the hooks.
+func exportLuaLineHooks(l *lua.LState, hooks []luaLineHook) {
+	l.SetGlobal(luaLineHookName, l.NewFunction(func(l *lua.LState) int {
+		file := l.CheckString(1)
+		line := l.CheckInt(2)
+		for _, h := range hooks {
+			h.luaLine(l, file, line)
+		}
+		return 0
+	}))
+}
+
+// loadInstrumentedLua loads a Lua chunk with line hooks.
+func loadInstrumentedLua(l *lua.LState, reader io.Reader, name string, hooks []luaLineHook) (*lua.LFunction, error) {
+	chunk, err := parse.Parse(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	ins := &luaInstrumenter{file: name, lines: map[int]bool{}}
+	proto, err := lua.Compile(ins.stmts(chunk), name)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]int, 0, len(ins.lines))
+	for line := range ins.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	for _, h := range hooks {
+		h.luaLoad(name, lines)
+	}
+	return l.NewFunctionFromProto(proto), nil
+}
+
+// luaInstrumenter inserts line hooks into a Lua chunk and records lines
+// that have statements.
+type luaInstrumenter struct {
+	file  string
+	lines map[int]bool
+}
+
+func (ins *luaInstrumenter) stmts(stmts []luaast.Stmt) []luaast.Stmt {
+	ret := make([]luaast.Stmt, 0, len(stmts)*2)
+	for _, stmt := range stmts {
+		ins.stmt(stmt)
+		ins.lines[stmt.Line()] = true
+		ret = append(ret, luaLineHookStmt(ins.file, stmt.Line()), stmt)
+	}
+	return ret
+}
+
+func luaLineHookStmt(file string, line int) luaast.Stmt {
+	fn := &luaast.IdentExpr{Value: luaLineHookName}
+	name := &luaast.StringExpr{Value: file}
+	number := &luaast.NumberExpr{Value: strconv.Itoa(line)}
+	call := &luaast.FuncCallExpr{Func: fn, Args: []luaast.Expr{name, number}}
+	stmt := &luaast.FuncCallStmt{Expr: call}
+	for _, n := range []luaast.PositionHolder{fn, name, number, call, stmt} {
+		n.SetLine(line)
+		n.SetLastLine(line)
+	}
+	return stmt
+}
+
+func (ins *luaInstrumenter) stmt(stmt luaast.Stmt) {
+	switch s := stmt.(type) {
+	case *luaast.AssignStmt:
+		ins.exprs(s.Lhs...)
+		ins.exprs(s.Rhs...)
+	case *luaast.LocalAssignStmt:
+		ins.exprs(s.Exprs...)
+	case *luaast.FuncCallStmt:
+		ins.exprs(s.Expr)
+	case *luaast.DoBlockStmt:
+		s.Stmts = ins.stmts(s.Stmts)
+	case *luaast.WhileStmt:
+		ins.exprs(s.Condition)
+		s.Stmts = ins.stmts(s.Stmts)
+	case *luaast.RepeatStmt:
+		ins.exprs(s.Condition)
+		s.Stmts = ins.stmts(s.Stmts)
+	case *luaast.IfStmt:
+		ins.exprs(s.Condition)
+		s.Then = ins.stmts(s.Then)
+		s.Else = ins.stmts(s.Else)
+	case *luaast.NumberForStmt:
+		ins.exprs(s.Init, s.Limit, s.Step)
+		s.Stmts = ins.stmts(s.Stmts)
+	case *luaast.GenericForStmt:
+		ins.exprs(s.Exprs...)
+		s.Stmts = ins.stmts(s.Stmts)
+	case *luaast.FuncDefStmt:
+		ins.exprs(s.Func)
+	case *luaast.ReturnStmt:
+		ins.exprs(s.Exprs...)
+	}
+}
+
+// exprs instruments functions in the expressions.
+func (ins *luaInstrumenter) exprs(exprs ...luaast.Expr) {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case *luaast.FunctionExpr:
+			e.Stmts = ins.stmts(e.Stmts)
+		case *luaast.AttrGetExpr:
+			ins.exprs(e.Object, e.Key)
+		case *luaast.TableExpr:
+			for _, field := range e.Fields {
+				ins.exprs(field.Key, field.Value)
+			}
+		case *luaast.FuncCallExpr:
+			ins.exprs(e.Func, e.Receiver)
+			ins.exprs(e.Args...)
+		case *luaast.LogicalOpExpr:
+			ins.exprs(e.Lhs, e.Rhs)
+		case *luaast.RelationalOpExpr:
+			ins.exprs(e.Lhs, e.Rhs)
+		case *luaast.StringConcatOpExpr:
+			ins.exprs(e.Lhs, e.Rhs)
+		case *luaast.ArithmeticOpExpr:
+			ins.exprs(e.Lhs, e.Rhs)
+		case *luaast.UnaryMinusOpExpr:
+			ins.exprs(e.Expr)
+		case *luaast.UnaryNotOpExpr:
+			ins.exprs(e.Expr)
+		case *luaast.UnaryLenOpExpr:
+			ins.exprs(e.Expr)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package dynamic
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+// luaReader is a text.Reader passed to Lua hooks. luaReader has Lua friendly
+// methods that return Lua strings in addition to methods of text.Reader.
+// Patterns of MatchCaptures and Consume are Go's regular expressions as a
+// string or a compiled *regexp.Regexp, and they match only at the current
+// position. 'match' is text.Reader.Match as is: it takes only a compiled
+// *regexp.Regexp and searches the rest of the source.
+type luaReader struct {
+	text.Reader
+	regexps *regexpCache
+
+	lines       *lineIndex
+	linesSource []byte
+}
+
+// luaMethodNames is luar's Config.MethodNames. Methods of luaReader that
+// have the 'Lua' prefix are exported without the prefix instead of methods of
+// text.Reader that have the same names(e.g. 'LuaPeek' is exported as 'peek'
+// instead of 'Peek'). luaReader implements text.Reader, so it can be passed
+// to Go functions as is.
+func luaMethodNames(t reflect.Type, m reflect.Method) []string {
+	name := m.Name
+	if t == reflect.TypeOf(&luaReader{}) {
+		if _, ok := t.MethodByName("Lua" + name); ok {
+			return nil
+		}
+		name = strings.TrimPrefix(name, "Lua")
+	}
+	first, n := utf8.DecodeRuneInString(name)
+	return []string{name, string(unicode.ToLower(first)) + name[n:]}
+}
+
+// luaReaderMark is a position saved by luaReader.Mark.
+type luaReaderMark struct {
+	line    int
+	segment text.Segment
+}
+
+// Mark returns the current position.
+func (r *luaReader) Mark(l *luar.LState) int {
+	line, segment := r.Position()
+	l.Push(luar.New(l.LState, &luaReaderMark{line: line, segment: segment}))
+	return 1
+}
+
+// Reset restores a position returned by Mark.
+func (r *luaReader) Reset(l *luar.LState) int {
+	m, ok := l.CheckUserData(1).Value.(*luaReaderMark)
+	if !ok {
+		l.ArgError(1, "mark expected")
+	}
+	r.SetPosition(m.line, m.segment)
+	return 0
+}
+
+// LuaPeek returns at most n characters of the current line as a Lua string and
+// its segment. Without n, LuaPeek returns the current character as a byte like
+// text.Reader.Peek .
+func (r *luaReader) LuaPeek(l *luar.LState) int {
+	if l.GetTop() == 0 {
+		l.Push(lua.LNumber(r.Reader.Peek()))
+		return 1
+	}
+	n := l.CheckInt(1)
+	if n < 0 {
+		l.ArgError(1, "must not be negative")
+	}
+	line, segment := r.PeekLine()
+	if n < len(line) {
+		line = line[:n]
+	}
+	l.Push(lua.LString(line))
+	l.Push(luar.New(l.LState, segment.WithStop(segment.Start+len(line))))
+	return 2
+}
+
+// MatchCaptures returns a match of the pattern at the current position like
+// string.match, or nil. MatchCaptures does not advance the reader.
+// Unlike text.Reader.Match, the pattern is anchored at the current position.
+func (r *luaReader) MatchCaptures(l *luar.LState) int {
+	return r.match(l, false)
+}
+
+// Consume is MatchCaptures that advances the reader to the end of the match.
+func (r *luaReader) Consume(l *luar.LState) int {
+	return r.match(l, true)
+}
+
+func (r *luaReader) match(l *luar.LState, advance bool) int {
+	re := r.regexps.check(l.LState, 1)
+	line, _ := r.PeekLine()
+	loc := re.FindSubmatchIndex(line)
+	if loc == nil || loc[0] != 0 {
+		l.Push(lua.LNil)
+		return 1
+	}
+	if advance {
+		r.Advance(loc[1])
+	}
+	if len(loc) == 2 {
+		l.Push(lua.LString(line[:loc[1]]))
+		return 1
+	}
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			l.Push(lua.LNil)
+		} else {
+			l.Push(lua.LString(line[loc[i]:loc[i+1]]))
+		}
+	}
+	return len(loc)/2 - 1
+}
+
+// LineNumber returns a 1-based line number of the current position in the
+// source. If a parser.Context is given, the line index of the document that
+// positions of nodes use is reused. Otherwise the reader caches its own
+// line index for the source.
+func (r *luaReader) LineNumber(l *luar.LState) int {
+	_, segment := r.Position()
+	source := r.Source()
+	var idx *lineIndex
+	if ud, ok := l.Get(1).(*lua.LUserData); ok {
+		pc, ok := ud.Value.(parser.Context)
+		if !ok {
+			l.ArgError(1, "parser.Context expected")
+		}
+		idx = getLineIndex(source, pc)
+	} else {
+		if r.lines == nil || !sameSource(r.linesSource, source) {
+			r.lines = newLineIndex(source)
+			r.linesSource = source
+		}
+		idx = r.lines
+	}
+	start := segment.Start
+	if start > len(source) {
+		start = len(source)
+	}
+	l.Push(lua.LNumber(idx.location(start).Line))
+	return 1
+}
+
+// sameSource reports whether a and b are the same slice.
+func sameSource(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// ReadUntil reads characters until the given character in the current line
+// and returns them as a Lua string and its segment. The reader advances to
+// the character. If the character is not found, ReadUntil returns nil and
+// does not advance the reader.
+func (r *luaReader) ReadUntil(l *luar.LState) int {
+	c := checkByte(l.LState, 1)
+	line, segment := r.PeekLine()
+	i := bytes.IndexByte(line, c)
+	if i < 0 {
+		l.Push(lua.LNil)
+		return 1
+	}
+	r.Advance(i)
+	l.Push(lua.LString(line[:i]))
+	l.Push(luar.New(l.LState, segment.WithStop(segment.Start+i)))
+	return 2
+}
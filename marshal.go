@@ -0,0 +1,223 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// nodePropsToMap returns props of dynamic nodes or fields of built-in nodes.
+func nodePropsToMap(node ast.Node, source []byte) map[string]any {
+	if pn, ok := node.(propsNode); ok {
+		props, _ := jsonValue(reflect.ValueOf(pn.Props()), source).(map[string]any)
+		return props
+	}
+	return structProps(reflect.ValueOf(node), source)
+}
+
+// NodeToMap converts the given node and its descendants into a map that
+// consists of JSON compatible values.
+//
+// A converted node has the following keys:
+//
+//   - kind: a name of the node kind
+//   - type: "document", "block" or "inline"
+//   - props: exported fields of built-in nodes(e.g. level of headings) or props of dynamic nodes
+//   - attributes: attributes of the node, if any
+//   - position: a position of the dynamic node, if any
+//   - lines: lines of the raw block node(e.g. code blocks), if any
+//   - children: converted child nodes
+//
+// source is used to get values of text segments. Values of text segments are
+// omitted if source is nil. Props tables that refer to themselves are
+// converted into null at the second visit.
+func NodeToMap(node ast.Node, source []byte) map[string]any {
+	m := map[string]any{
+		"kind": node.Kind().String(),
+	}
+	switch node.Type() {
+	case ast.TypeDocument:
+		m["type"] = "document"
+	case ast.TypeBlock:
+		m["type"] = "block"
+	default:
+		m["type"] = "inline"
+	}
+
+	if props := nodePropsToMap(node, source); len(props) != 0 {
+		m["props"] = props
+	}
+
+	a := map[string]any{}
+	for _, attr := range node.Attributes() {
+		if isInternalAttribute(attr.Name) {
+			continue
+		}
+		a[string(attr.Name)] = jsonValue(reflect.ValueOf(attr.Value), source)
+	}
+	if len(a) != 0 {
+		m["attributes"] = a
+	}
+
+	if pn, ok := node.(PositionedNode); ok && pn.Position() != (Position{}) {
+		m["position"] = positionToMap(pn.Position())
+	}
+
+	if source != nil && node.Type() == ast.TypeBlock && node.IsRaw() && node.Lines().Len() != 0 {
+		m["lines"] = segmentsToStrings(node.Lines(), source)
+	}
+
+	children := []any{}
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		children = append(children, NodeToMap(c, source))
+	}
+	m["children"] = children
+	return m
+}
+
+// NodeToJSON converts the given node and its descendants into JSON.
+// See [NodeToMap] for details.
+func NodeToJSON(node ast.Node, source []byte) ([]byte, error) {
+	return json.Marshal(NodeToMap(node, source))
+}
+
+type propsNode interface {
+	Props() map[string]any
+}
+
+var (
+	bytesType    = reflect.TypeOf([]byte(nil))
+	segmentType  = reflect.TypeOf(text.Segment{})
+	segmentsType = reflect.TypeOf(&text.Segments{})
+	nodeType     = reflect.TypeOf((*ast.Node)(nil)).Elem()
+)
+
+func structProps(v reflect.Value, source []byte) map[string]any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	props := map[string]any{}
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for k, value := range structProps(v.Field(i), source) {
+				props[k] = value
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		value := jsonValue(v.Field(i), source)
+		if value == nil {
+			continue
+		}
+		props[lowerFirst(field.Name)] = value
+	}
+	return props
+}
+
+func jsonValue(v reflect.Value, source []byte) any {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case bytesType:
+		return string(v.Bytes())
+	case segmentType:
+		if source == nil {
+			return nil
+		}
+		segment := v.Interface().(text.Segment)
+		return string(segment.Value(source))
+	case segmentsType:
+		if v.IsNil() || source == nil {
+			return nil
+		}
+		return segmentsToStrings(v.Interface().(*text.Segments), source)
+	}
+	if v.Type().Implements(nodeType) {
+		if v.IsNil() || source == nil {
+			return nil
+		}
+		if t, ok := v.Interface().(*ast.Text); ok {
+			return string(t.Segment.Value(source))
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Uint8:
+		return string(rune(v.Uint()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return jsonValue(v.Elem(), source)
+	case reflect.Slice, reflect.Array:
+		ret := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, jsonValue(v.Index(i), source))
+		}
+		return ret
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		ret := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ret[iter.Key().String()] = jsonValue(iter.Value(), source)
+		}
+		return ret
+	}
+	return nil
+}
+
+func segmentsToStrings(segments *text.Segments, source []byte) []any {
+	ret := make([]any, 0, segments.Len())
+	for i := 0; i < segments.Len(); i++ {
+		segment := segments.At(i)
+		ret = append(ret, string(segment.Value(source)))
+	}
+	return ret
+}
+
+func positionToMap(p Position) map[string]any {
+	location := func(l Location) map[string]any {
+		return map[string]any{
+			"offset": l.Offset,
+			"line":   l.Line,
+			"column": l.Column,
+		}
+	}
+	return map[string]any{
+		"start": location(p.Start),
+		"stop":  location(p.Stop),
+	}
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
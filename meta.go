@@ -0,0 +1,162 @@
+package dynamic
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var documentMetaKey = parser.NewContextKey()
+
+// documentMetaAttribute is a name of an attribute of ast.Document that holds
+// metadata while rendering.
+var documentMetaAttribute = []byte(internalAttributePrefix + "meta")
+
+// documentMeta is metadata produced by extensions.
+// Metadata of the document(e.g. front matter stored by goldmark-meta with
+// meta.WithStoresInDocument()) is used for missing keys.
+type documentMeta struct {
+	values map[string]any
+	doc    *ast.Document
+}
+
+func (m *documentMeta) get(key string) any {
+	if v, ok := m.values[key]; ok {
+		return v
+	}
+	if m.doc != nil {
+		return m.doc.Meta()[key]
+	}
+	return nil
+}
+
+func (m *documentMeta) set(key string, value any) {
+	m.values[key] = value
+}
+
+func (m *documentMeta) append(key string, value any) {
+	if list, ok := m.values[key].([]any); ok {
+		m.values[key] = append(list, value)
+		return
+	}
+	list, _ := m.get(key).([]any)
+	m.values[key] = append(append([]any{}, list...), value)
+}
+
+func (m *documentMeta) all() map[string]any {
+	ret := map[string]any{}
+	if m.doc != nil {
+		for key, value := range m.doc.Meta() {
+			ret[key] = value
+		}
+	}
+	for key, value := range m.values {
+		ret[key] = value
+	}
+	return ret
+}
+
+// metaOf returns metadata of the v that is a parser.Context or an ast.Node.
+func metaOf(v any) *documentMeta {
+	switch c := v.(type) {
+	case parser.Context:
+		m, ok := c.Get(documentMetaKey).(*documentMeta)
+		if !ok {
+			m = &documentMeta{values: map[string]any{}}
+			c.Set(documentMetaKey, m)
+		}
+		return m
+	case ast.Node:
+		doc := c.OwnerDocument()
+		if doc == nil {
+			break
+		}
+		if v, ok := doc.AttributeString(string(documentMetaAttribute)); ok {
+			return v.(*documentMeta)
+		}
+		m := &documentMeta{values: map[string]any{}, doc: doc}
+		doc.SetAttribute(documentMetaAttribute, m)
+		return m
+	}
+	return &documentMeta{values: map[string]any{}}
+}
+
+// DocumentMeta returns metadata of the document.
+// v is a parser.Context or an ast.Node in the document.
+// Returned metadata consists of metadata of the ast.Document(e.g. front
+// matter) and metadata produced by extensions via the goldmark.meta module.
+// Metadata produced by extensions takes precedence.
+//
+//	pc := parser.NewContext()
+//	markdown.Convert(source, &buf, parser.WithContext(pc))
+//	wordCount := dynamic.DocumentMeta(pc)["wordCount"]
+func DocumentMeta(v any) map[string]any {
+	return metaOf(v).all()
+}
+
+// documentMetaTransformer links metadata in the parser.Context to the
+// document, so transformers can read metadata of the document and renderers
+// can read and write the same metadata.
+type documentMetaTransformer struct {
+}
+
+func (t *documentMetaTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	m := metaOf(pc)
+	if v, ok := node.AttributeString(string(documentMetaAttribute)); ok {
+		for key, value := range v.(*documentMeta).values {
+			m.values[key] = value
+		}
+	}
+	m.doc = node
+	node.SetAttribute(documentMetaAttribute, m)
+}
+
+func goldmarkMetaMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name: "get",
+			value: func(v any, key string) any {
+				return metaOf(v).get(key)
+			},
+		},
+		{
+			name: "set",
+			value: func(v any, key string, value any) {
+				metaOf(v).set(key, value)
+			},
+		},
+		{
+			name: "append",
+			value: func(v any, key string, value any) {
+				metaOf(v).append(key, value)
+			},
+		},
+		{
+			name:  "all",
+			value: DocumentMeta,
+		},
+	}
+}
+
+func exportGoldmarkMeta(r *luaRuntime, l *lua.LState, mod *lua.LTable) {
+	mod.RawSetString("get", l.NewFunction(func(l *lua.LState) int {
+		m := metaOf(l.CheckUserData(1).Value)
+		l.Push(goToLua(l, m.get(l.CheckString(2))))
+		return 1
+	}))
+	mod.RawSetString("set", l.NewFunction(func(l *lua.LState) int {
+		m := metaOf(l.CheckUserData(1).Value)
+		m.set(l.CheckString(2), luaToGo(l.Get(3)))
+		return 0
+	}))
+	mod.RawSetString("append", l.NewFunction(func(l *lua.LState) int {
+		m := metaOf(l.CheckUserData(1).Value)
+		m.append(l.CheckString(2), luaToGo(l.Get(3)))
+		return 0
+	}))
+	mod.RawSetString("all", l.NewFunction(func(l *lua.LState) int {
+		l.Push(goToLua(l, DocumentMeta(l.CheckUserData(1).Value)))
+		return 1
+	}))
+}
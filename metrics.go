@@ -0,0 +1,161 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Hook names recorded by [Metrics].
+const (
+	HookBlockParserOpen               = "BlockParser.Open"
+	HookBlockParserContinue           = "BlockParser.Continue"
+	HookBlockParserClose              = "BlockParser.Close"
+	HookInlineParserParse             = "InlineParser.Parse"
+	HookInlineParserCloseBlock        = "InlineParser.CloseBlock"
+	HookParagraphTransformerTransform = "ParagraphTransformer.Transform"
+	HookASTTransformerTransform       = "ASTTransformer.Transform"
+	HookNodeRendererRender            = "NodeRenderer.Render"
+	HookNodeIsRaw                     = "Node.IsRaw"
+	HookNodeDump                      = "Node.Dump"
+)
+
+// HookMetric is call counts and cumulative time of a hook of an extension.
+type HookMetric struct {
+	// Extension is a name of the extension.
+	Extension string `json:"extension"`
+
+	// Hook is a name of the hook(e.g. "InlineParser.Parse").
+	Hook string `json:"hook"`
+
+	// Kind is a name of the node kind for renderers and nodes.
+	// Renderers are called twice for each node(entering and leaving).
+	Kind string `json:"kind,omitempty"`
+
+	// Calls is a number of calls.
+	Calls int64 `json:"calls"`
+
+	// Duration is cumulative time of calls.
+	Duration time.Duration `json:"duration"`
+}
+
+type hookKey struct {
+	extension string
+	hook      string
+	kind      string
+}
+
+type hookCounter struct {
+	calls atomic.Int64
+	nanos atomic.Int64
+}
+
+// start returns the current time if the c is not nil.
+func (c *hookCounter) start() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe records a call that started at the given time.
+func (c *hookCounter) observe(start time.Time) {
+	if c == nil {
+		return
+	}
+	c.calls.Add(1)
+	c.nanos.Add(int64(time.Since(start)))
+}
+
+// Metrics records call counts and cumulative time of hooks(parsers,
+// transformers and renderers) per extension, hook and node kind.
+// Metrics implements expvar.Var, so it can be published by expvar.Publish.
+// Metrics is safe for concurrent use.
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[hookKey]*hookCounter
+}
+
+// NewMetrics returns a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters: map[hookKey]*hookCounter{},
+	}
+}
+
+func (m *Metrics) counter(extension, hook, kind string) *hookCounter {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := hookKey{extension: extension, hook: hook, kind: kind}
+	c, ok := m.counters[key]
+	if !ok {
+		c = &hookCounter{}
+		m.counters[key] = c
+	}
+	return c
+}
+
+// Snapshot returns metrics of hooks that have been called, sorted by
+// cumulative time in descending order.
+func (m *Metrics) Snapshot() []HookMetric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]HookMetric, 0, len(m.counters))
+	for key, c := range m.counters {
+		calls := c.calls.Load()
+		if calls == 0 {
+			continue
+		}
+		ret = append(ret, HookMetric{
+			Extension: key.extension,
+			Hook:      key.hook,
+			Kind:      key.kind,
+			Calls:     calls,
+			Duration:  time.Duration(c.nanos.Load()),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Duration != ret[j].Duration {
+			return ret[i].Duration > ret[j].Duration
+		}
+		if ret[i].Extension != ret[j].Extension {
+			return ret[i].Extension < ret[j].Extension
+		}
+		if ret[i].Hook != ret[j].Hook {
+			return ret[i].Hook < ret[j].Hook
+		}
+		return ret[i].Kind < ret[j].Kind
+	})
+	return ret
+}
+
+// Reset resets all metrics.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.counters {
+		c.calls.Store(0)
+		c.nanos.Store(0)
+	}
+}
+
+// String returns metrics as a JSON array. String implements expvar.Var.
+func (m *Metrics) String() string {
+	b, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(b)
+}
+
+// WithMetrics is an option that records metrics of hooks into the m.
+func WithMetrics(m *Metrics) Option {
+	return func(e *dynamic) {
+		e.metrics = m
+	}
+}
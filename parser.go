@@ -6,151 +6,158 @@ import (
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
-	lua "github.com/yuin/gopher-lua"
-	luar "layeh.com/gopher-luar"
 )
 
-func exportGoldmarkParser(l *lua.LState, opts options) {
-	l.PreloadModule("goldmark.parser", func(l *lua.LState) int {
-		mod := l.NewTable()
-		for _, def := range []struct {
-			name  string
-			value any
-		}{
-			{
-				name:  "none",
-				value: parser.None,
-			},
-			{
-				name:  "close",
-				value: parser.Close,
-			},
-			{
-				name:  "continue",
-				value: parser.Continue,
-			},
-			{
-				name:  "hasChildren",
-				value: parser.HasChildren,
-			},
-			{
-				name:  "noChildren",
-				value: parser.NoChildren,
-			},
-			{
-				name:  "requireParagraph",
-				value: parser.RequireParagraph,
-			},
-			{
-				name:  "defaultBlockParsers",
-				value: parser.DefaultBlockParsers,
-			},
-			{
-				name:  "defaultInlineParsers",
-				value: parser.DefaultInlineParsers,
-			},
-			{
-				name:  "defaultParagraphTransformers",
-				value: parser.DefaultParagraphTransformers,
-			},
-			{
-				name:  "processDelimiters",
-				value: parser.ProcessDelimiters,
-			},
-			{
-				name:  "newContextKey",
-				value: parser.NewContextKey,
-			},
-			{
-				name:  "newReference",
-				value: parser.NewReference,
-			},
-			{
-				name:  "scanDelimiter",
-				value: parser.ScanDelimiter,
-			},
-			{
-				name:  "withInlineParsers",
-				value: parser.WithInlineParsers,
-			},
-			{
-				name:  "withBlockParsers",
-				value: parser.WithBlockParsers,
-			},
-			{
-				name:  "withASTTransformers",
-				value: parser.WithASTTransformers,
-			},
-			{
-				name:  "withParagraphTransformers",
-				value: parser.WithParagraphTransformers,
-			},
-		} {
-			mod.RawSetString(def.name, luar.New(l, def.value))
-		}
+func goldmarkParserMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name:  "none",
+			value: parser.None,
+		},
+		{
+			name:  "close",
+			value: parser.Close,
+		},
+		{
+			name:  "continue",
+			value: parser.Continue,
+		},
+		{
+			name:  "hasChildren",
+			value: parser.HasChildren,
+		},
+		{
+			name:  "noChildren",
+			value: parser.NoChildren,
+		},
+		{
+			name:  "requireParagraph",
+			value: parser.RequireParagraph,
+		},
+		{
+			name:  "defaultBlockParsers",
+			value: parser.DefaultBlockParsers,
+		},
+		{
+			name:  "defaultInlineParsers",
+			value: parser.DefaultInlineParsers,
+		},
+		{
+			name:  "defaultParagraphTransformers",
+			value: parser.DefaultParagraphTransformers,
+		},
+		{
+			name:  "processDelimiters",
+			value: parser.ProcessDelimiters,
+		},
+		{
+			name:  "newContextKey",
+			value: parser.NewContextKey,
+		},
+		{
+			name:  "newReference",
+			value: parser.NewReference,
+		},
+		{
+			name:  "scanDelimiter",
+			value: parser.ScanDelimiter,
+		},
+		{
+			name:  "newDelimiter",
+			value: newDelimiter,
+		},
+		{
+			name:  "parseDelimiter",
+			value: parseDelimiter,
+		},
+		{
+			name:  "withInlineParsers",
+			value: parser.WithInlineParsers,
+		},
+		{
+			name:  "withBlockParsers",
+			value: parser.WithBlockParsers,
+		},
+		{
+			name:  "withASTTransformers",
+			value: parser.WithASTTransformers,
+		},
+		{
+			name:  "withParagraphTransformers",
+			value: parser.WithParagraphTransformers,
+		},
+	}
+}
 
-		mod.RawSetString("newInlineParser", l.NewFunction(func(l *lua.LState) int {
-			parser := newDynamicInlineParser(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, parser)
-			l.Push(ud)
-			return 1
-		}))
-
-		mod.RawSetString("newBlockParser", l.NewFunction(func(l *lua.LState) int {
-			parser := newDynamicBlockParser(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, parser)
-			l.Push(ud)
-			return 1
-		}))
-
-		mod.RawSetString("newASTTransformer", l.NewFunction(func(l *lua.LState) int {
-			parser := newDynamicASTTransformer(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, parser)
-			l.Push(ud)
-			return 1
-		}))
-
-		mod.RawSetString("newParagraphTransformer", l.NewFunction(func(l *lua.LState) int {
-			parser := newDynamicParagraphTransformer(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, parser)
-			l.Push(ud)
-			return 1
-		}))
-		mod.RawSetString("newDelimiterProcessor", l.NewFunction(func(l *lua.LState) int {
-			parser := newDynamicDelimiterProcessor(l, l.CheckTable(1), opts.OnError())
-			ud := luar.New(l, parser)
-			l.Push(ud)
-			return 1
-		}))
-
-		l.Push(mod)
-		return 1
-	})
+var goldmarkParserConstructors = []moduleConstructor{
+	{
+		name:   "newInlineParser",
+		object: "InlineParser",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicInlineParser(obj, onError)
+		},
+	},
+	{
+		name:   "newBlockParser",
+		object: "BlockParser",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicBlockParser(obj, onError)
+		},
+	},
+	{
+		name:   "newASTTransformer",
+		object: "ASTTransformer",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicASTTransformer(obj, onError)
+		},
+	},
+	{
+		name:   "newParagraphTransformer",
+		object: "ParagraphTransformer",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicParagraphTransformer(obj, onError)
+		},
+	},
+	{
+		name:   "newDelimiterProcessor",
+		object: "DelimiterProcessor",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newDynamicDelimiterProcessor(obj, onError)
+		},
+	},
+	{
+		name:   "inlinePattern",
+		object: "InlinePattern",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newPatternInlineParser(obj, onError)
+		},
+	},
+	{
+		name:   "fencedBlock",
+		object: "FencedBlock",
+		fn: func(obj scriptObject, onError func(error)) any {
+			return newFencedBlockParser(obj, onError)
+		},
+	},
 }
 
 var _ parser.InlineParser = (*dynamicInlineParser)(nil)
 
 type dynamicInlineParser struct {
-	l       *lua.LState
-	props   *lua.LTable
 	onError func(error)
 
 	trigger    []byte
-	parse      lua.LValue
-	closeBlock lua.LValue
+	parse      scriptFunc
+	closeBlock scriptFunc
 }
 
-func newDynamicInlineParser(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicInlineParser {
-	pt := newPropTable(l, "InlineParser", props, onError)
-
+func newDynamicInlineParser(obj scriptObject, onError func(error)) *dynamicInlineParser {
 	return &dynamicInlineParser{
-		l:       l,
-		props:   props,
 		onError: onError,
 
-		trigger:    pt.Bytes("triggers"),
-		parse:      pt.Get("parse", lua.LTFunction),
-		closeBlock: pt.Get("closeBlock", lua.LTFunction, lua.LTNil),
+		trigger:    obj.Bytes("triggers"),
+		parse:      obj.Func("parse", true),
+		closeBlock: obj.Func("closeBlock", false),
 	}
 }
 
@@ -159,47 +166,36 @@ func (s *dynamicInlineParser) Trigger() []byte {
 }
 
 func (s *dynamicInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
-	if s.parse == lua.LNil {
+	if s.parse == nil {
 		return nil
 	}
-	l := s.l
+	_, segment := block.Position()
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.parse.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, parent), luar.New(l, block), luar.New(l, pc)); err != nil {
+	ret, err := s.parse.call(1, s, parent, block, pc)
+	if err != nil {
 		s.onError(err)
-	}
-	ret := l.Get(-1)
-	l.Pop(1)
-	if ret == lua.LNil {
 		return nil
 	}
-
-	if _, err := mustLValue(ret, lua.LTUserData); err != nil {
-		s.onError(fmt.Errorf("InlineParser.parse returns an invalid value: %w", err))
+	if ret[0] == nil {
 		return nil
 	}
-	node, ok := ret.(*lua.LUserData).Value.(ast.Node)
+
+	node, ok := ret[0].(ast.Node)
 	if !ok {
-		s.onError(fmt.Errorf("InlineParser.open must return an ast.Node"))
+		s.onError(fmt.Errorf("InlineParser.parse must return an ast.Node"))
+		return nil
 	}
+	recordPosition(node, segment.Start, block, pc)
 
 	return node
 }
 
 func (s *dynamicInlineParser) CloseBlock(parent ast.Node, block text.Reader, pc parser.Context) {
-	if s.closeBlock == lua.LNil {
+	if s.closeBlock == nil {
 		return
 	}
-	l := s.l
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.closeBlock.(*lua.LFunction),
-		NRet:    0,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, parent), luar.New(l, block), luar.New(l, pc)); err != nil {
+	if _, err := s.closeBlock.call(0, s, parent, block, pc); err != nil {
 		s.onError(err)
 	}
 }
@@ -207,36 +203,31 @@ func (s *dynamicInlineParser) CloseBlock(parent ast.Node, block text.Reader, pc
 var _ parser.BlockParser = (*dynamicBlockParser)(nil)
 
 type dynamicBlockParser struct {
-	l       *lua.LState
-	props   *lua.LTable
 	onError func(error)
 
 	trigger               []byte
-	fopen                 lua.LValue
-	fcontinue             lua.LValue
-	fclose                lua.LValue
+	fopen                 scriptFunc
+	fcontinue             scriptFunc
+	fclose                scriptFunc
 	canInterruptParagraph bool
 	canAcceptIndentedLine bool
 }
 
-func newDynamicBlockParser(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicBlockParser {
-	pt := newPropTable(l, "BlockParser", props, onError)
-	trigger := pt.Bytes("triggers")
+func newDynamicBlockParser(obj scriptObject, onError func(error)) *dynamicBlockParser {
+	trigger := obj.Bytes("triggers")
 	if len(trigger) == 0 {
 		onError(fmt.Errorf("Can not define BlockParser without triggers"))
 	}
 
 	return &dynamicBlockParser{
-		l:       l,
-		props:   props,
 		onError: onError,
 
 		trigger:               trigger,
-		fopen:                 pt.Get("open", lua.LTFunction),
-		fcontinue:             pt.Get("continue", lua.LTFunction),
-		fclose:                pt.Get("close", lua.LTFunction),
-		canInterruptParagraph: pt.Bool("canInterruptParagraph"),
-		canAcceptIndentedLine: pt.Bool("canAcceptIndentedLine"),
+		fopen:                 obj.Func("open", true),
+		fcontinue:             obj.Func("continue", true),
+		fclose:                obj.Func("close", true),
+		canInterruptParagraph: obj.Bool("canInterruptParagraph"),
+		canAcceptIndentedLine: obj.Bool("canAcceptIndentedLine"),
 	}
 }
 
@@ -245,77 +236,60 @@ func (s *dynamicBlockParser) Trigger() []byte {
 }
 
 func (s *dynamicBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
-	if s.fopen == lua.LNil {
+	if s.fopen == nil {
 		return nil, parser.Close
 	}
-	l := s.l
+	_, segment := reader.Position()
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.fopen.(*lua.LFunction),
-		NRet:    2,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, parent), luar.New(l, reader), luar.New(l, pc)); err != nil {
+	ret, err := s.fopen.call(2, s, parent, reader, pc)
+	if err != nil {
 		s.onError(err)
-	}
-	ret2 := l.Get(-1)
-	l.Pop(1)
-	ret1 := l.Get(-1)
-	l.Pop(1)
-	if ret1 == lua.LNil {
 		return nil, parser.Close
 	}
-
-	if _, err := mustLValue(ret1, lua.LTUserData); err != nil {
-		s.onError(fmt.Errorf("BlockParser.open returns an invalid value: %w", err))
+	if ret[0] == nil {
 		return nil, parser.Close
 	}
-	if _, err := mustLValue(ret2, lua.LTNumber); err != nil {
-		s.onError(fmt.Errorf("BlockParser.open returns an invalid value: %w", err))
+
+	node, ok := ret[0].(ast.Node)
+	if !ok {
+		s.onError(fmt.Errorf("BlockParser.open must return an ast.Node"))
 		return nil, parser.Close
 	}
-	ud, ok := ret1.(*lua.LUserData).Value.(ast.Node)
+	state, ok := toInt(ret[1])
 	if !ok {
-		s.onError(fmt.Errorf("BlockParser.open must return an ast.Node"))
+		s.onError(fmt.Errorf("BlockParser.open returns an invalid value: must be a number"))
+		return nil, parser.Close
 	}
+	recordPosition(node, segment.Start, reader, pc)
 
-	return ud, parser.State(int(ret2.(lua.LNumber)))
-
+	return node, parser.State(state)
 }
 
 func (s *dynamicBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
-	if s.fcontinue == lua.LNil {
+	if s.fcontinue == nil {
 		return parser.Close
 	}
-	l := s.l
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.fcontinue.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, node), luar.New(l, reader), luar.New(l, pc)); err != nil {
+	ret, err := s.fcontinue.call(1, s, node, reader, pc)
+	if err != nil {
 		s.onError(err)
+		return parser.Close
 	}
-	ret1 := l.Get(-1)
-	l.Pop(1)
-	if _, err := mustLValue(ret1, lua.LTNumber); err != nil {
-		s.onError(fmt.Errorf("BlockParser.continue returns an invalid value: %w", err))
+	state, ok := toInt(ret[0])
+	if !ok {
+		s.onError(fmt.Errorf("BlockParser.continue returns an invalid value: must be a number"))
 		return parser.Close
 	}
-	return parser.State(int(ret1.(lua.LNumber)))
+	extendPosition(node, reader, pc)
+	return parser.State(state)
 }
 
 func (s *dynamicBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
-	if s.fclose == lua.LNil {
+	if s.fclose == nil {
 		return
 	}
 
-	l := s.l
-
-	if err := l.CallByParam(lua.P{
-		Fn:      s.fclose.(*lua.LFunction),
-		NRet:    0,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, node), luar.New(l, reader), luar.New(l, pc)); err != nil {
+	if _, err := s.fclose.call(0, s, node, reader, pc); err != nil {
 		s.onError(err)
 	}
 }
@@ -331,36 +305,25 @@ func (s *dynamicBlockParser) CanAcceptIndentedLine() bool {
 var _ parser.ASTTransformer = (*dynamicASTTransformer)(nil)
 
 type dynamicASTTransformer struct {
-	l       *lua.LState
-	props   *lua.LTable
 	onError func(error)
 
-	transform lua.LValue
+	transform scriptFunc
 }
 
-func newDynamicASTTransformer(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicASTTransformer {
-	pt := newPropTable(l, "ASTTransformer", props, onError)
-
+func newDynamicASTTransformer(obj scriptObject, onError func(error)) *dynamicASTTransformer {
 	return &dynamicASTTransformer{
-		l:       l,
-		props:   props,
 		onError: onError,
 
-		transform: pt.Get("transform", lua.LTFunction),
+		transform: obj.Func("transform", true),
 	}
 }
 
 func (s *dynamicASTTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
-	if s.transform == lua.LNil {
+	if s.transform == nil {
 		return
 	}
-	l := s.l
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.transform.(*lua.LFunction),
-		NRet:    0,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, node), luar.New(l, reader), luar.New(l, pc)); err != nil {
+	if _, err := s.transform.call(0, s, node, reader, pc); err != nil {
 		s.onError(err)
 	}
 }
@@ -368,37 +331,25 @@ func (s *dynamicASTTransformer) Transform(node *ast.Document, reader text.Reader
 var _ parser.ParagraphTransformer = (*dynamicParagraphTransformer)(nil)
 
 type dynamicParagraphTransformer struct {
-	l       *lua.LState
-	props   *lua.LTable
 	onError func(error)
 
-	transform lua.LValue
+	transform scriptFunc
 }
 
-func newDynamicParagraphTransformer(l *lua.LState, props *lua.LTable,
-	onError func(error)) *dynamicParagraphTransformer {
-	pt := newPropTable(l, "ParagraphTransformer", props, onError)
-
+func newDynamicParagraphTransformer(obj scriptObject, onError func(error)) *dynamicParagraphTransformer {
 	return &dynamicParagraphTransformer{
-		l:       l,
-		props:   props,
 		onError: onError,
 
-		transform: pt.Get("transform", lua.LTFunction),
+		transform: obj.Func("transform", true),
 	}
 }
 
 func (s *dynamicParagraphTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
-	if s.transform == lua.LNil {
+	if s.transform == nil {
 		return
 	}
-	l := s.l
 
-	if err := l.CallByParam(lua.P{
-		Fn:      s.transform.(*lua.LFunction),
-		NRet:    0,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, node), luar.New(l, reader), luar.New(l, pc)); err != nil {
+	if _, err := s.transform.call(0, s, node, reader, pc); err != nil {
 		s.onError(err)
 	}
 }
@@ -406,93 +357,102 @@ func (s *dynamicParagraphTransformer) Transform(node *ast.Paragraph, reader text
 var _ parser.DelimiterProcessor = (*dynamicDelimiterProcessor)(nil)
 
 type dynamicDelimiterProcessor struct {
-	l       *lua.LState
-	props   *lua.LTable
 	onError func(error)
 
-	isDelimiter   lua.LValue
-	canOpenCloser lua.LValue
-	onMatch       lua.LValue
+	isDelimiter   scriptFunc
+	canOpenCloser scriptFunc
+	onMatch       scriptFunc
 }
 
-func newDynamicDelimiterProcessor(l *lua.LState, props *lua.LTable, onError func(error)) *dynamicDelimiterProcessor {
-	pt := newPropTable(l, "ParagraphTransformer", props, onError)
-
+func newDynamicDelimiterProcessor(obj scriptObject, onError func(error)) *dynamicDelimiterProcessor {
 	return &dynamicDelimiterProcessor{
-		l:       l,
-		props:   props,
 		onError: onError,
 
-		isDelimiter:   pt.Get("isDelimiter", lua.LTFunction),
-		canOpenCloser: pt.Get("canOpenCloser", lua.LTFunction),
-		onMatch:       pt.Get("onMatch", lua.LTFunction),
+		isDelimiter:   obj.Func("isDelimiter", true),
+		canOpenCloser: obj.Func("canOpenCloser", true),
+		onMatch:       obj.Func("onMatch", true),
 	}
 }
 
 func (s *dynamicDelimiterProcessor) IsDelimiter(b byte) bool {
-	l := s.l
-
-	if err := l.CallByParam(lua.P{
-		Fn:      s.isDelimiter.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, b)); err != nil {
+	ret, err := s.isDelimiter.call(1, s, b)
+	if err != nil {
 		s.onError(err)
+		return false
 	}
-	ret := l.Get(-1)
-	l.Pop(1)
-	_, err := mustLValue(ret, lua.LTBool)
-	if err != nil {
-		s.onError(fmt.Errorf("DelimiterProcessor.isDelimiter returns an invalid value: %w", err))
+	v, ok := ret[0].(bool)
+	if !ok {
+		s.onError(fmt.Errorf("DelimiterProcessor.isDelimiter returns an invalid value: must be a boolean"))
 	}
-	return bool(ret.(lua.LBool))
-
+	return v
 }
 
 func (s *dynamicDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
-	l := s.l
-
-	if err := l.CallByParam(lua.P{
-		Fn:      s.canOpenCloser.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, luar.New(l, s), luar.New(l, opener), luar.New(l, closer)); err != nil {
+	ret, err := s.canOpenCloser.call(1, s, opener, closer)
+	if err != nil {
 		s.onError(err)
+		return false
 	}
-	ret := l.Get(-1)
-	l.Pop(1)
-	_, err := mustLValue(ret, lua.LTBool)
-	if err != nil {
-		s.onError(fmt.Errorf("DelimiterProcessor.canOpenCloser returns an invalid value: %w", err))
+	v, ok := ret[0].(bool)
+	if !ok {
+		s.onError(fmt.Errorf("DelimiterProcessor.canOpenCloser returns an invalid value: must be a boolean"))
 	}
-	return bool(ret.(lua.LBool))
-
+	return v
 }
 
 func (s *dynamicDelimiterProcessor) OnMatch(consumes int) ast.Node {
-	l := s.l
-
-	if err := l.CallByParam(lua.P{
-		Fn:      s.onMatch.(*lua.LFunction),
-		NRet:    1,
-		Protect: true,
-	}, luar.New(l, consumes)); err != nil {
+	ret, err := s.onMatch.call(1, s, consumes)
+	if err != nil {
 		s.onError(err)
-	}
-	ret := l.Get(-1)
-	l.Pop(1)
-	if ret == lua.LNil {
 		return nil
 	}
-
-	if _, err := mustLValue(ret, lua.LTUserData); err != nil {
-		s.onError(fmt.Errorf("DelimiterProcessor.onMatch returns an invalid value: %w", err))
+	if ret[0] == nil {
 		return nil
 	}
-	node, ok := ret.(*lua.LUserData).Value.(ast.Node)
+
+	node, ok := ret[0].(ast.Node)
 	if !ok {
 		s.onError(fmt.Errorf("DelimiterProcessor.onMatch must return an ast.Node"))
 	}
 
 	return node
 }
+
+// newDelimiter is parser.NewDelimiter that accepts a delimiter character as
+// a string or a byte.
+func newDelimiter(canOpen, canClose bool, length int, char any,
+	processor parser.DelimiterProcessor) *parser.Delimiter {
+	return parser.NewDelimiter(canOpen, canClose, length, toByte(char), processor)
+}
+
+// parseDelimiter scans a delimiter that has at least min characters at the
+// current position of the block like emphasis parsers. If a delimiter is
+// found, parseDelimiter advances the block, pushes the delimiter to the pc
+// and returns the delimiter. Inline parsers can return the delimiter as is.
+func parseDelimiter(block text.Reader, pc parser.Context, min int,
+	processor parser.DelimiterProcessor) *parser.Delimiter {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	if len(line) == 0 {
+		return nil
+	}
+	node := parser.ScanDelimiter(line, before, min, processor)
+	if node == nil {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func toByte(v any) byte {
+	if s, ok := v.(string); ok {
+		if len(s) == 0 {
+			return 0
+		}
+		return s[0]
+	}
+	i, _ := toInt(v)
+	return byte(i)
+}
@@ -0,0 +1,126 @@
+package dynamic
+
+import (
+	"sort"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Location is a location in the source text.
+type Location struct {
+	// Offset is a 0-based byte offset from the beginning of the source.
+	Offset int
+
+	// Line is a 1-based line number.
+	Line int
+
+	// Column is a 1-based byte offset from the beginning of the line.
+	Column int
+}
+
+// Position is a range of the source text consumed by a parser.
+type Position struct {
+	Start Location
+	Stop  Location
+}
+
+// PositionedNode is an ast.Node that knows a range of the source text it was
+// parsed from.
+//
+// Nodes created by gast.newInlineNode and gast.newBlockNode implement this
+// interface. Positions are recorded automatically by dynamic parsers:
+// an inline node spans the bytes consumed by InlineParser.parse and a block node
+// spans the bytes consumed from BlockParser.open to the last BlockParser.continue.
+type PositionedNode interface {
+	ast.Node
+
+	// Position returns a position of this node.
+	// Position returns a zero value if this node has not been parsed by
+	// dynamic parsers.
+	Position() Position
+}
+
+type positionRecorder interface {
+	PositionedNode
+	setPosition(Position)
+}
+
+type nodePosition struct {
+	position Position
+}
+
+func (n *nodePosition) Position() Position {
+	return n.position
+}
+
+func (n *nodePosition) setPosition(v Position) {
+	n.position = v
+}
+
+var lineIndexKey = parser.NewContextKey()
+
+type lineIndex struct {
+	starts []int
+}
+
+func getLineIndex(source []byte, pc parser.Context) *lineIndex {
+	if v, ok := pc.Get(lineIndexKey).(*lineIndex); ok {
+		return v
+	}
+	idx := newLineIndex(source)
+	pc.Set(lineIndexKey, idx)
+	return idx
+}
+
+func newLineIndex(source []byte) *lineIndex {
+	idx := &lineIndex{starts: []int{0}}
+	for i, c := range source {
+		if c == '\n' {
+			idx.starts = append(idx.starts, i+1)
+		}
+	}
+	return idx
+}
+
+func (i *lineIndex) location(offset int) Location {
+	line := sort.Search(len(i.starts), func(j int) bool {
+		return i.starts[j] > offset
+	})
+	return Location{
+		Offset: offset,
+		Line:   line,
+		Column: offset - i.starts[line-1] + 1,
+	}
+}
+
+func recordPosition(node ast.Node, start int, reader text.Reader, pc parser.Context) {
+	p, ok := node.(positionRecorder)
+	if !ok {
+		return
+	}
+	_, segment := reader.Position()
+	if segment.Start < 0 {
+		return
+	}
+	idx := getLineIndex(reader.Source(), pc)
+	p.setPosition(Position{
+		Start: idx.location(start),
+		Stop:  idx.location(segment.Start),
+	})
+}
+
+func extendPosition(node ast.Node, reader text.Reader, pc parser.Context) {
+	p, ok := node.(positionRecorder)
+	if !ok {
+		return
+	}
+	_, segment := reader.Position()
+	pos := p.Position()
+	if segment.Start < 0 || segment.Start <= pos.Stop.Offset {
+		return
+	}
+	pos.Stop = getLineIndex(reader.Source(), pc).location(segment.Start)
+	p.setPosition(pos)
+}
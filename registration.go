@@ -0,0 +1,145 @@
+package dynamic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// RegistrationType is a type of [Registration].
+type RegistrationType string
+
+const (
+	// RegistrationBlockParser is a parser.BlockParser.
+	RegistrationBlockParser RegistrationType = "BlockParser"
+
+	// RegistrationInlineParser is a parser.InlineParser.
+	RegistrationInlineParser RegistrationType = "InlineParser"
+
+	// RegistrationParagraphTransformer is a parser.ParagraphTransformer.
+	RegistrationParagraphTransformer RegistrationType = "ParagraphTransformer"
+
+	// RegistrationASTTransformer is a parser.ASTTransformer.
+	RegistrationASTTransformer RegistrationType = "ASTTransformer"
+
+	// RegistrationNodeRenderer is a renderer.NodeRenderer.
+	RegistrationNodeRenderer RegistrationType = "NodeRenderer"
+)
+
+// Registration is a parser, a transformer or a renderer registered by an
+// extension.
+type Registration struct {
+	// Extension is a name of the extension.
+	Extension string
+
+	// Type is a type of the registration.
+	Type RegistrationType
+
+	// Priority is a priority of the registration.
+	Priority int
+
+	// Triggers are trigger characters of parsers.
+	Triggers []byte
+
+	// Kinds are node kinds rendered by renderers.
+	Kinds []ast.NodeKind
+}
+
+// String implements fmt.Stringer.
+func (r Registration) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s(priority=%d", r.Extension, r.Type, r.Priority)
+	if len(r.Triggers) != 0 {
+		fmt.Fprintf(&b, ", triggers=%q", r.Triggers)
+	}
+	if len(r.Kinds) != 0 {
+		kinds := make([]string, 0, len(r.Kinds))
+		for _, kind := range r.Kinds {
+			kinds = append(kinds, kind.String())
+		}
+		fmt.Fprintf(&b, ", kinds=%s", strings.Join(kinds, ","))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Conflict is registrations of different extensions that share a trigger
+// character or a node kind. Parsers that have smaller priority values are
+// tried first, and a renderer that has the smallest priority value renders
+// nodes. Registrations are sorted by priorities.
+type Conflict struct {
+	// Type is a type of conflicting registrations.
+	Type RegistrationType
+
+	// Trigger is a trigger character shared by parsers.
+	Trigger byte
+
+	// Kind is a node kind shared by renderers.
+	Kind ast.NodeKind
+
+	// Registrations are conflicting registrations.
+	Registrations []Registration
+}
+
+// String implements fmt.Stringer.
+func (c Conflict) String() string {
+	exts := make([]string, 0, len(c.Registrations))
+	for _, r := range c.Registrations {
+		exts = append(exts, fmt.Sprintf("%s(priority=%d)", r.Extension, r.Priority))
+	}
+	target := fmt.Sprintf("trigger %q", c.Trigger)
+	if c.Type == RegistrationNodeRenderer {
+		target = "kind " + c.Kind.String()
+	}
+	return fmt.Sprintf("%s: %s is registered by %s", c.Type, target, strings.Join(exts, ", "))
+}
+
+// findConflicts returns conflicts between the given registrations.
+func findConflicts(registrations []Registration) []Conflict {
+	type key struct {
+		typ     RegistrationType
+		trigger byte
+		kind    ast.NodeKind
+	}
+	keys := []key{}
+	groups := map[key][]Registration{}
+	add := func(k key, r Registration) {
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		for _, g := range groups[k] {
+			if g.Extension == r.Extension {
+				return
+			}
+		}
+		groups[k] = append(groups[k], r)
+	}
+	for _, r := range registrations {
+		for _, trigger := range r.Triggers {
+			add(key{typ: r.Type, trigger: trigger}, r)
+		}
+		for _, kind := range r.Kinds {
+			add(key{typ: r.Type, kind: kind}, r)
+		}
+	}
+
+	conflicts := []Conflict{}
+	for _, k := range keys {
+		rs := groups[k]
+		if len(rs) < 2 {
+			continue
+		}
+		sort.SliceStable(rs, func(i, j int) bool {
+			return rs[i].Priority < rs[j].Priority
+		})
+		conflicts = append(conflicts, Conflict{
+			Type:          k.typ,
+			Trigger:       k.trigger,
+			Kind:          k.kind,
+			Registrations: rs,
+		})
+	}
+	return conflicts
+}
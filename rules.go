@@ -0,0 +1,286 @@
+package dynamic
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultRulePriority = 999
+
+// RuleRuntime is a RuntimeFactory for declarative rule files written in
+// YAML(.yaml, .yml) or JSON(.json).
+var RuleRuntime = NewRuntimeFactory([]string{".yaml", ".yml", ".json"}, func(config *RuntimeConfig) Runtime {
+	return &ruleRuntime{config: config}
+})
+
+type ruleRuntime struct {
+	config *RuntimeConfig
+}
+
+func (r *ruleRuntime) Load(m goldmark.Markdown, extension Extension) (map[string]Function, error) {
+	return nil, loadRuleFile(r.config.FS, extension.File, m, r.config.OnError)
+}
+
+func (r *ruleRuntime) Close() {
+}
+
+// ruleFile is a declarative rule file written in YAML or JSON.
+// JSON files are parsed as YAML since JSON is a subset of YAML.
+type ruleFile struct {
+	Inlines    []*syntaxRuleConfig    `yaml:"inlines"`
+	Blocks     []*syntaxRuleConfig    `yaml:"blocks"`
+	Attributes []*attributeRuleConfig `yaml:"attributes"`
+}
+
+type syntaxRuleConfig struct {
+	Triggers              string            `yaml:"triggers"`
+	Pattern               string            `yaml:"pattern"`
+	Open                  string            `yaml:"open"`
+	Close                 string            `yaml:"close"`
+	Raw                   bool              `yaml:"raw"`
+	CanInterruptParagraph *bool             `yaml:"canInterruptParagraph"`
+	Kind                  string            `yaml:"kind"`
+	Defaults              map[string]string `yaml:"defaults"`
+	HTML                  htmlTemplate      `yaml:"html"`
+	Priority              int               `yaml:"priority"`
+}
+
+// newSyntaxRule compiles the config into a syntaxRule without script
+// runtimes.
+func (c *syntaxRuleConfig) newSyntaxRule(name string, onError func(error)) *syntaxRule {
+	r := &syntaxRule{
+		onError: onError,
+
+		name:     name,
+		trigger:  []byte(c.Triggers),
+		defaults: make(map[string]any, len(c.Defaults)),
+		enter:    c.HTML.Enter,
+		exit:     c.HTML.Exit,
+	}
+	if len(r.trigger) == 0 {
+		onError(fmt.Errorf("can not define %s without triggers", name))
+	}
+	if len(c.Kind) == 0 {
+		onError(fmt.Errorf("can not define %s without kind", name))
+	} else {
+		r.kind = ast.NewNodeKind(c.Kind)
+	}
+	for k, v := range c.Defaults {
+		r.defaults[k] = v
+	}
+	return r
+}
+
+// compilePattern compiles the pattern if it is not empty.
+func (c *syntaxRuleConfig) compilePattern(name, key, pattern string, onError func(error)) *regexp.Regexp {
+	if len(pattern) == 0 {
+		return nil
+	}
+	return compileAnchoredPattern(name, key, pattern, onError)
+}
+
+func (c *syntaxRuleConfig) newInlineParser(onError func(error)) *patternInlineParser {
+	const name = "InlinePattern"
+	return &patternInlineParser{
+		syntaxRule: c.newSyntaxRule(name, onError),
+		pattern:    c.compilePattern(name, "pattern", c.Pattern, onError),
+	}
+}
+
+func (c *syntaxRuleConfig) newBlockParser(onError func(error)) *fencedBlockParser {
+	const name = "FencedBlock"
+	canInterruptParagraph := true
+	if c.CanInterruptParagraph != nil {
+		canInterruptParagraph = *c.CanInterruptParagraph
+	}
+	return &fencedBlockParser{
+		syntaxRule: c.newSyntaxRule(name, onError),
+
+		open:                  c.compilePattern(name, "open", c.Open, onError),
+		close:                 c.compilePattern(name, "close", c.Close, onError),
+		raw:                   c.Raw,
+		canInterruptParagraph: canInterruptParagraph,
+	}
+}
+
+// htmlTemplate is a string(an enter template) or a mapping that has
+// enter and exit templates.
+type htmlTemplate struct {
+	Enter string `yaml:"enter"`
+	Exit  string `yaml:"exit"`
+}
+
+func (t *htmlTemplate) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		t.Enter = value.Value
+		return nil
+	}
+	type plain htmlTemplate
+	return value.Decode((*plain)(t))
+}
+
+type attributeRuleConfig struct {
+	Kind     string            `yaml:"kind"`
+	Match    map[string]string `yaml:"match"`
+	Exclude  map[string]string `yaml:"exclude"`
+	Set      map[string]string `yaml:"set"`
+	Priority int               `yaml:"priority"`
+}
+
+func priorityOf(v int) int {
+	if v == 0 {
+		return defaultRulePriority
+	}
+	return v
+}
+
+func loadRuleFile(f fs.FS, file string, m goldmark.Markdown, onError func(error)) error {
+	fp, err := f.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var rules ruleFile
+	decoder := yaml.NewDecoder(fp)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	for i, config := range rules.Inlines {
+		onError := prefixError(onError, "%s: inlines[%d]", file, i)
+		rule := config.newInlineParser(onError)
+		m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(rule, priorityOf(config.Priority))))
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(rule.NewRenderer(),
+			priorityOf(config.Priority))))
+	}
+	for i, config := range rules.Blocks {
+		onError := prefixError(onError, "%s: blocks[%d]", file, i)
+		rule := config.newBlockParser(onError)
+		m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(rule, priorityOf(config.Priority))))
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(rule.NewRenderer(),
+			priorityOf(config.Priority))))
+	}
+	for i, config := range rules.Attributes {
+		transformer, err := newAttributeRewriter(config)
+		if err != nil {
+			return fmt.Errorf("%s: attributes[%d]: %w", file, i, err)
+		}
+		m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(transformer,
+			priorityOf(config.Priority))))
+	}
+	return nil
+}
+
+func prefixError(onError func(error), format string, args ...any) func(error) {
+	prefix := fmt.Sprintf(format, args...)
+	return func(err error) {
+		onError(fmt.Errorf("%s: %w", prefix, err))
+	}
+}
+
+var _ parser.ASTTransformer = (*attributeRewriter)(nil)
+
+// attributeRewriter sets attributes to nodes that have a specified kind and
+// props that match specified patterns.
+type attributeRewriter struct {
+	kind    string
+	match   map[string]*regexp.Regexp
+	exclude map[string]*regexp.Regexp
+	names   []string
+	values  [][]byte
+}
+
+func newAttributeRewriter(config *attributeRuleConfig) (*attributeRewriter, error) {
+	if len(config.Kind) == 0 {
+		return nil, fmt.Errorf("can not define an attribute rule without kind")
+	}
+	r := &attributeRewriter{
+		kind:    config.Kind,
+		match:   map[string]*regexp.Regexp{},
+		exclude: map[string]*regexp.Regexp{},
+	}
+	for name := range config.Set {
+		r.names = append(r.names, name)
+	}
+	sort.Strings(r.names)
+	for _, name := range r.names {
+		r.values = append(r.values, []byte(config.Set[name]))
+	}
+	for _, v := range []struct {
+		patterns map[string]string
+		regexps  map[string]*regexp.Regexp
+	}{
+		{config.Match, r.match},
+		{config.Exclude, r.exclude},
+	} {
+		for name, pattern := range v.patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			v.regexps[name] = re
+		}
+	}
+	return r, nil
+}
+
+func (r *attributeRewriter) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Kind().String() != r.kind {
+			return ast.WalkContinue, nil
+		}
+		var props map[string]any
+		if pn, ok := n.(propsNode); ok {
+			props = pn.Props()
+		} else {
+			props = structProps(reflect.ValueOf(n), source)
+		}
+		if !r.matches(props) {
+			return ast.WalkContinue, nil
+		}
+		for i, name := range r.names {
+			n.SetAttributeString(name, r.values[i])
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (r *attributeRewriter) matches(props map[string]any) bool {
+	value := func(name string) []byte {
+		switch v := props[name].(type) {
+		case nil:
+			return []byte{}
+		case []byte:
+			return v
+		case string:
+			return []byte(v)
+		default:
+			return []byte(fmt.Sprint(v))
+		}
+	}
+	for name, re := range r.match {
+		if !re.Match(value(name)) {
+			return false
+		}
+	}
+	for name, re := range r.exclude {
+		if re.Match(value(name)) {
+			return false
+		}
+	}
+	return true
+}
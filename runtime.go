@@ -0,0 +1,306 @@
+package dynamic
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// RuntimeConfig is a configuration for runtimes.
+type RuntimeConfig struct {
+	// FS is a file system that extension files are loaded from.
+	FS fs.StatFS
+
+	// OnError is a function that will be called when script errors occur.
+	OnError func(error)
+
+	// GoModules are modules that consist of Go values provided by host
+	// applications. Keys are module names.
+	GoModules map[string]map[string]any
+
+	// LuaModules are Lua module loaders provided by host applications.
+	// Keys are module names.
+	LuaModules map[string]lua.LGFunction
+
+	// Logger is a logger for the goldmark.log module. If Logger is nil,
+	// slog.Default() is used.
+	Logger *slog.Logger
+
+	// PrintOutput is a writer that print functions of Lua, JavaScript and
+	// Starlark scripts write to. If PrintOutput is nil, print functions
+	// write to os.Stdout. Outputs of WebAssembly modules are discarded.
+	PrintOutput io.Writer
+
+	// LuaDebugger is a debugger for Lua extensions.
+	LuaDebugger *LuaDebugger
+
+	// LuaCoverage records coverage of Lua extensions.
+	LuaCoverage *LuaCoverage
+}
+
+// modules returns built-in modules and GoModules.
+func (c *RuntimeConfig) modules() []*module {
+	modules := commonModules()
+	names := make([]string, 0, len(c.GoModules))
+	for name := range c.GoModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := c.GoModules[name]
+		modules = append(modules, &module{
+			name: name,
+			members: func() []moduleMember {
+				members := make([]moduleMember, 0, len(values))
+				for _, key := range sortedKeys(values) {
+					members = append(members, moduleMember{name: key, value: values[key]})
+				}
+				return members
+			},
+		})
+	}
+	return modules
+}
+
+// printOutput returns PrintOutput or os.Stdout.
+func (c *RuntimeConfig) printOutput() io.Writer {
+	if c.PrintOutput == nil {
+		return os.Stdout
+	}
+	return c.PrintOutput
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Runtime is a script runtime that loads extension files.
+// A Runtime is created per goldmark.Markdown.
+type Runtime interface {
+	// Load loads the given extension and extends the m with it.
+	// Load returns functions exported by the extension.
+	Load(m goldmark.Markdown, extension Extension) (map[string]Function, error)
+
+	// Close releases resources held by this runtime.
+	Close()
+}
+
+// Function is a function exported by extensions.
+// Arguments and return values are converted between Go values and script
+// values.
+type Function func(args ...any) ([]any, error)
+
+// RuntimeFactory creates runtimes.
+type RuntimeFactory interface {
+	// CanLoad returns true if runtimes created by this factory can load
+	// the given file.
+	CanLoad(file string) bool
+
+	// New returns a new Runtime.
+	New(config *RuntimeConfig) Runtime
+}
+
+type runtimeFactory struct {
+	extensions []string
+	new        func(config *RuntimeConfig) Runtime
+}
+
+func (f *runtimeFactory) CanLoad(file string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	for _, e := range f.extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *runtimeFactory) New(config *RuntimeConfig) Runtime {
+	return f.new(config)
+}
+
+// NewRuntimeFactory returns a new RuntimeFactory that creates runtimes for
+// files that have one of the given extensions(e.g. ".lua").
+func NewRuntimeFactory(extensions []string, f func(config *RuntimeConfig) Runtime) RuntimeFactory {
+	exts := make([]string, 0, len(extensions))
+	for _, ext := range extensions {
+		exts = append(exts, strings.ToLower(ext))
+	}
+	return &runtimeFactory{
+		extensions: exts,
+		new:        f,
+	}
+}
+
+// scriptFunc is a function defined in extension scripts.
+type scriptFunc interface {
+	// call calls this function with the given Go values and returns nret
+	// values converted into Go values.
+	call(nret int, args ...any) ([]any, error)
+}
+
+// scriptObject is an object defined in extension scripts that holds
+// properties for wrappers like parsers and nodes.
+// Type errors are reported by onError.
+type scriptObject interface {
+	// Func returns a function. Func returns nil if the function is not defined.
+	Func(key string, required bool) scriptFunc
+
+	// Bytes returns a string value as bytes.
+	Bytes(key string) []byte
+
+	// Bool returns a value as a bool. Undefined values are false.
+	Bool(key string) bool
+
+	// Int returns a number value as an int.
+	Int(key string) int
+
+	// Value returns a value converted into a Go value. Functions are
+	// converted into scriptFunc.
+	Value(key string) any
+
+	// Props returns a table value as nodeProps.
+	Props(key string) nodeProps
+}
+
+// nodeProps is props of dynamic nodes.
+type nodeProps interface {
+	// get returns a value in a form of the runtime that the props belong to.
+	get(name string) any
+
+	// toMap returns props converted into Go values.
+	toMap() map[string]any
+}
+
+type mapProps map[string]any
+
+func (p mapProps) get(name string) any {
+	return p[name]
+}
+
+func (p mapProps) toMap() map[string]any {
+	return p
+}
+
+// toInt converts numbers including named integer types like ast.NodeKind
+// into an int.
+func toInt(v any) (int, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) {
+			return 0, false
+		}
+		return int(f), true
+	}
+	return 0, false
+}
+
+// stringKeys converts keys of the given map into strings.
+func stringKeys(m map[any]any) map[string]any {
+	ret := make(map[string]any, len(m))
+	for k, v := range m {
+		ret[fmt.Sprint(k)] = v
+	}
+	return ret
+}
+
+// moduleMember is a Go value exported to scripts as a member of modules.
+type moduleMember struct {
+	name  string
+	value any
+}
+
+// moduleConstructor is a function that is exported to scripts as a
+// constructor of Go objects like parsers and nodes.
+type moduleConstructor struct {
+	name   string
+	object string
+	fn     func(obj scriptObject, onError func(error)) any
+}
+
+// module is a module exported to all runtimes.
+type module struct {
+	name         string
+	members      func() []moduleMember
+	constructors []moduleConstructor
+}
+
+func commonModules() []*module {
+	return []*module{
+		{
+			name:    "bit32",
+			members: bit32Members,
+		},
+		{
+			name:    "go.bytes",
+			members: goBytesMembers,
+		},
+		{
+			name:    "goldmark",
+			members: goldmarkMembers,
+		},
+		{
+			name:    "goldmark.util",
+			members: goldmarkUtilMembers,
+		},
+		{
+			name:    "goldmark.text.segment",
+			members: goldmarkTextSegmentMembers,
+		},
+		{
+			name:         "goldmark.ast",
+			members:      goldmarkASTMembers,
+			constructors: goldmarkASTConstructors,
+		},
+		{
+			name:         "goldmark.parser",
+			members:      goldmarkParserMembers,
+			constructors: goldmarkParserConstructors,
+		},
+		{
+			name:    "goldmark.renderer",
+			members: goldmarkRendererMembers,
+		},
+		{
+			name:         "goldmark.renderer.html",
+			members:      goldmarkRendererHTMLMembers,
+			constructors: goldmarkRendererHTMLConstructors,
+		},
+		{
+			name:    "goldmark.dynamic",
+			members: goldmarkDynamicMembers,
+		},
+		{
+			name:    "goldmark.meta",
+			members: goldmarkMetaMembers,
+		},
+		{
+			name:    "goldmark.parser.context",
+			members: goldmarkParserContextMembers,
+		},
+	}
+}
@@ -0,0 +1,707 @@
+package dynamic
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// StarlarkRuntime is a RuntimeFactory for Starlark scripts(.star).
+//
+// Starlark extensions are deterministic and hermetic: scripts can not access
+// clocks, random numbers or files other than modules loaded by load
+// statements, and globals of modules are frozen after loading.
+// An extension file must define a function extend(m, opts).
+// Available modules are same as [JavaScriptRuntime].
+var StarlarkRuntime = NewRuntimeFactory([]string{".star"}, func(config *RuntimeConfig) Runtime {
+	return newStarlarkRuntime(config)
+})
+
+type starlarkRuntime struct {
+	config  *RuntimeConfig
+	thread  *starlark.Thread
+	modules map[string]starlark.StringDict
+	builtin map[string]*module
+}
+
+func newStarlarkRuntime(config *RuntimeConfig) *starlarkRuntime {
+	r := &starlarkRuntime{
+		config:  config,
+		modules: map[string]starlark.StringDict{},
+		builtin: map[string]*module{},
+	}
+	r.thread = &starlark.Thread{
+		Name: "goldmark-dynamic",
+		Load: func(_ *starlark.Thread, name string) (starlark.StringDict, error) {
+			return r.load(name)
+		},
+		Print: func(_ *starlark.Thread, msg string) {
+			_, _ = fmt.Fprintln(config.printOutput(), msg)
+		},
+	}
+	for _, m := range config.modules() {
+		r.builtin[m.name] = m
+	}
+	r.builtin["goldmark.text"] = &module{
+		name: "goldmark.text",
+		members: func() []moduleMember {
+			return []moduleMember{
+				{
+					name:  "newSegment",
+					value: text.NewSegment,
+				},
+				{
+					name:  "newSegmentPadding",
+					value: text.NewSegmentPadding,
+				},
+			}
+		},
+	}
+	return r
+}
+
+func (r *starlarkRuntime) load(name string) (starlark.StringDict, error) {
+	if globals, ok := r.modules[name]; ok {
+		return globals, nil
+	}
+	var globals starlark.StringDict
+	if m, ok := r.builtin[name]; ok {
+		globals = r.newModule(m)
+	} else {
+		var err error
+		globals, err = r.execFile(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	globals.Freeze()
+	r.modules[name] = globals
+	return globals, nil
+}
+
+func (r *starlarkRuntime) newModule(m *module) starlark.StringDict {
+	globals := starlark.StringDict{}
+	for _, member := range m.members() {
+		globals[member.name] = r.fromGo(member.value)
+	}
+	for _, c := range m.constructors {
+		c := c
+		globals[c.name] = starlark.NewBuiltin(c.name, func(_ *starlark.Thread, fn *starlark.Builtin,
+			args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			props, err := constructorProps(fn, args, kwargs)
+			if err != nil {
+				return nil, err
+			}
+			obj := &starlarkObject{r: r, name: c.object, dict: props, onError: r.config.OnError}
+			return r.fromGo(c.fn(obj, r.config.OnError)), nil
+		})
+	}
+	if extend, ok := starlarkModuleExtensions[m.name]; ok {
+		extend(r, globals)
+	}
+	return globals
+}
+
+// constructorProps returns properties passed as a dict or keyword arguments.
+func constructorProps(fn *starlark.Builtin, args starlark.Tuple,
+	kwargs []starlark.Tuple) (*starlark.Dict, error) {
+	if len(args) == 1 && len(kwargs) == 0 {
+		if d, ok := args[0].(*starlark.Dict); ok {
+			return d, nil
+		}
+	}
+	if len(args) != 0 {
+		return nil, fmt.Errorf("%s: a dict or keyword arguments expected", fn.Name())
+	}
+	d := starlark.NewDict(len(kwargs))
+	for _, kv := range kwargs {
+		_ = d.SetKey(kv[0], kv[1])
+	}
+	return d, nil
+}
+
+// starlarkModuleExtensions are Starlark specific members of common modules.
+var starlarkModuleExtensions = map[string]func(r *starlarkRuntime, globals starlark.StringDict){
+	"goldmark.ast": func(r *starlarkRuntime, globals starlark.StringDict) {
+		globals["toTable"] = r.fromGo(func(node ast.Node, source []byte) map[string]any {
+			return NodeToMap(node, source)
+		})
+	},
+}
+
+func (r *starlarkRuntime) execFile(file string) (starlark.StringDict, error) {
+	source, err := fs.ReadFile(r.config.FS, file)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.ExecFileOptions(&syntax.FileOptions{}, r.thread, file, source, nil)
+}
+
+func (r *starlarkRuntime) Load(m goldmark.Markdown, extension Extension) (map[string]Function, error) {
+	globals, err := r.load(extension.File)
+	if err != nil {
+		return nil, err
+	}
+	extend, ok := globals["extend"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("goldmark-dynamic starlark extension must define a function extend(m, opts)")
+	}
+
+	// global functions except private functions(prefixed with '_') are
+	// exported.
+	functions := map[string]Function{}
+	for _, name := range globals.Keys() {
+		if fn, ok := globals[name].(starlark.Callable); ok && name != "extend" && !strings.HasPrefix(name, "_") {
+			functions[name] = r.function(fn)
+		}
+	}
+	_, err = starlark.Call(r.thread, extend, starlark.Tuple{r.fromGo(m), r.fromGo(extension.Options)}, nil)
+	return functions, err
+}
+
+func (r *starlarkRuntime) function(fn starlark.Callable) Function {
+	return func(args ...any) ([]any, error) {
+		sargs := make(starlark.Tuple, 0, len(args))
+		for _, arg := range args {
+			sargs = append(sargs, r.fromGo(arg))
+		}
+		v, err := starlark.Call(r.thread, fn, sargs, nil)
+		if err != nil {
+			return nil, err
+		}
+		if tuple, ok := v.(starlark.Tuple); ok {
+			ret := make([]any, 0, len(tuple))
+			for _, e := range tuple {
+				ret = append(ret, r.toGo(e))
+			}
+			return ret, nil
+		}
+		return []any{r.toGo(v)}, nil
+	}
+}
+
+func (r *starlarkRuntime) Close() {
+	r.thread.Cancel("closed")
+}
+
+// fromGo converts a Go value into a Starlark value.
+// Numbers, strings(including byte slices), booleans, slices and maps are
+// converted into Starlark values, other values are wrapped.
+func (r *starlarkRuntime) fromGo(value any) starlark.Value {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None
+	case starlark.Value:
+		return v
+	case []byte:
+		return starlark.String(v)
+	case map[any]any:
+		d := starlark.NewDict(len(v))
+		for key, e := range v {
+			_ = d.SetKey(r.fromGo(key), r.fromGo(e))
+		}
+		return d
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return starlark.Bool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(rv.Float())
+	case reflect.String:
+		return starlark.String(rv.String())
+	case reflect.Map:
+		if rv.IsNil() {
+			return starlark.None
+		}
+		d := starlark.NewDict(rv.Len())
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			_ = d.SetKey(r.fromGo(key.Interface()), r.fromGo(rv.MapIndex(key).Interface()))
+		}
+		return d
+	case reflect.Slice:
+		if rv.Type() == reflect.TypeOf([]any{}) {
+			l := make([]starlark.Value, 0, rv.Len())
+			for i := 0; i < rv.Len(); i++ {
+				l = append(l, r.fromGo(rv.Index(i).Interface()))
+			}
+			return starlark.NewList(l)
+		}
+	case reflect.Func:
+		if rv.IsNil() {
+			return starlark.None
+		}
+		return &starlarkGoFunc{r: r, v: rv, name: rv.Type().String()}
+	}
+	return &starlarkGoValue{r: r, v: rv}
+}
+
+// toGo converts a Starlark value into a Go value.
+// Functions are converted into scriptFunc.
+func (r *starlarkRuntime) toGo(value starlark.Value) any {
+	switch v := value.(type) {
+	case nil, starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		return bool(v)
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return int(i)
+		}
+		return v.String()
+	case starlark.Float:
+		return float64(v)
+	case starlark.String:
+		return string(v)
+	case starlark.Bytes:
+		return []byte(v)
+	case *starlark.Dict:
+		ret := make(map[string]any, v.Len())
+		for _, kv := range v.Items() {
+			key, ok := starlark.AsString(kv[0])
+			if !ok {
+				key = kv[0].String()
+			}
+			ret[key] = r.toGo(kv[1])
+		}
+		return ret
+	case starlark.Indexable:
+		ret := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, r.toGo(v.Index(i)))
+		}
+		return ret
+	}
+	switch v := value.(type) {
+	case *starlarkGoValue:
+		return v.v.Interface()
+	case *starlarkGoFunc:
+		return v.v.Interface()
+	case starlark.Callable:
+		return &starlarkFunc{r: r, fn: v}
+	}
+	return value
+}
+
+// toReflect converts a Starlark value into a Go value that has the given type.
+func (r *starlarkRuntime) toReflect(value starlark.Value, typ reflect.Type) (reflect.Value, error) {
+	switch v := value.(type) {
+	case *starlarkGoValue:
+		if v.v.Type().AssignableTo(typ) {
+			return v.v, nil
+		}
+		if v.v.Type().ConvertibleTo(typ) {
+			return v.v.Convert(typ), nil
+		}
+	case *starlarkGoFunc:
+		if v.v.Type().AssignableTo(typ) {
+			return v.v, nil
+		}
+	case starlark.NoneType:
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(typ), nil
+		}
+	case starlark.Callable:
+		if typ.Kind() == reflect.Func {
+			return r.makeFunc(v, typ), nil
+		}
+	}
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		if seq, ok := value.(starlark.Indexable); ok {
+			ret := reflect.MakeSlice(typ, 0, seq.Len())
+			for i := 0; i < seq.Len(); i++ {
+				e, err := r.toReflect(seq.Index(i), typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				ret = reflect.Append(ret, e)
+			}
+			return ret, nil
+		}
+	}
+	goValue := r.toGo(value)
+	if goValue == nil {
+		if typ.Kind() == reflect.Interface {
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, fmt.Errorf("can not convert None into %s", typ)
+	}
+	rv := reflect.ValueOf(goValue)
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.String {
+		return reflect.ValueOf([]byte(rv.String())).Convert(typ), nil
+	}
+	if rv.Type().AssignableTo(typ) {
+		return rv, nil
+	}
+	if rv.Kind() != reflect.String && rv.Type().ConvertibleTo(typ) && typ.Kind() != reflect.String {
+		return rv.Convert(typ), nil
+	}
+	if rv.Kind() == reflect.String && typ.Kind() == reflect.String {
+		return rv.Convert(typ), nil
+	}
+	return reflect.Value{}, fmt.Errorf("can not convert %s into %s", value.Type(), typ)
+}
+
+// makeFunc converts a Starlark function into a Go function.
+// Functions return multiple values as a tuple.
+func (r *starlarkRuntime) makeFunc(fn starlark.Callable, typ reflect.Type) reflect.Value {
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		sargs := make(starlark.Tuple, 0, len(args))
+		for _, arg := range args {
+			sargs = append(sargs, r.fromGo(arg.Interface()))
+		}
+		results := make([]reflect.Value, typ.NumOut())
+		for i := range results {
+			results[i] = reflect.Zero(typ.Out(i))
+		}
+		errorType := reflect.TypeOf((*error)(nil)).Elem()
+		setError := func(err error) []reflect.Value {
+			if len(results) != 0 && typ.Out(len(results)-1) == errorType {
+				results[len(results)-1] = reflect.ValueOf(&err).Elem()
+				return results
+			}
+			panic(err)
+		}
+		ret, err := starlark.Call(r.thread, fn, sargs, nil)
+		if err != nil {
+			return setError(err)
+		}
+		values := []starlark.Value{ret}
+		if tuple, ok := ret.(starlark.Tuple); ok && len(results) > 1 {
+			values = tuple
+		}
+		for i := 0; i < len(results) && i < len(values); i++ {
+			if values[i] == starlark.None {
+				continue
+			}
+			v, err := r.toReflect(values[i], typ.Out(i))
+			if err != nil {
+				return setError(fmt.Errorf("%s returns an invalid value: %w", fn.Name(), err))
+			}
+			results[i] = v
+		}
+		return results
+	})
+}
+
+func upperFirst(s string) string {
+	c, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(c)) + s[size:]
+}
+
+// starlarkGoValue is a Go value wrapped as a Starlark value.
+// Fields and methods are accessible with names that the first letter is
+// lower-cased.
+type starlarkGoValue struct {
+	r *starlarkRuntime
+	v reflect.Value
+}
+
+func (v *starlarkGoValue) String() string {
+	return fmt.Sprint(v.v.Interface())
+}
+
+func (v *starlarkGoValue) Type() string {
+	return "go:" + v.v.Type().String()
+}
+
+func (v *starlarkGoValue) Freeze() {
+}
+
+func (v *starlarkGoValue) Truth() starlark.Bool {
+	switch v.v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return !starlark.Bool(v.v.IsNil())
+	}
+	return starlark.True
+}
+
+func (v *starlarkGoValue) Hash() (uint32, error) {
+	if v.v.Kind() == reflect.Ptr {
+		return uint32(v.v.Pointer()), nil
+	}
+	return 0, fmt.Errorf("unhashable type: %s", v.Type())
+}
+
+func (v *starlarkGoValue) Attr(name string) (starlark.Value, error) {
+	goName := upperFirst(name)
+	if m := v.v.MethodByName(goName); m.IsValid() {
+		return &starlarkGoFunc{r: v.r, v: m, name: name}, nil
+	}
+	s := v.v
+	for s.Kind() == reflect.Ptr || s.Kind() == reflect.Interface {
+		if s.IsNil() {
+			return nil, nil
+		}
+		s = s.Elem()
+	}
+	if s.Kind() == reflect.Struct {
+		if f, ok := s.Type().FieldByName(goName); ok && f.IsExported() {
+			return v.r.fromGo(s.FieldByIndex(f.Index).Interface()), nil
+		}
+	}
+	return nil, nil
+}
+
+func (v *starlarkGoValue) AttrNames() []string {
+	names := []string{}
+	t := v.v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, lowerFirst(t.Method(i).Name))
+	}
+	s := t
+	for s.Kind() == reflect.Ptr {
+		s = s.Elem()
+	}
+	if s.Kind() == reflect.Struct {
+		for _, f := range reflect.VisibleFields(s) {
+			if f.IsExported() {
+				names = append(names, lowerFirst(f.Name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (v *starlarkGoValue) CompareSameType(op syntax.Token, y starlark.Value, _ int) (bool, error) {
+	w := y.(*starlarkGoValue)
+	if !v.v.Comparable() || !w.v.Comparable() {
+		return false, fmt.Errorf("%s is not comparable", v.Type())
+	}
+	switch op {
+	case syntax.EQL:
+		return v.v.Interface() == w.v.Interface(), nil
+	case syntax.NEQ:
+		return v.v.Interface() != w.v.Interface(), nil
+	}
+	return false, fmt.Errorf("%s is not supported for %s", op, v.Type())
+}
+
+// starlarkGoFunc is a Go function wrapped as a Starlark callable.
+// Functions that return multiple values return a tuple.
+type starlarkGoFunc struct {
+	r    *starlarkRuntime
+	v    reflect.Value
+	name string
+}
+
+func (f *starlarkGoFunc) String() string {
+	return "<go function " + f.name + ">"
+}
+
+func (f *starlarkGoFunc) Type() string {
+	return "go:function"
+}
+
+func (f *starlarkGoFunc) Freeze() {
+}
+
+func (f *starlarkGoFunc) Truth() starlark.Bool {
+	return starlark.True
+}
+
+func (f *starlarkGoFunc) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: %s", f.Type())
+}
+
+func (f *starlarkGoFunc) Name() string {
+	return f.name
+}
+
+func (f *starlarkGoFunc) CallInternal(_ *starlark.Thread, args starlark.Tuple,
+	kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) != 0 {
+		return nil, fmt.Errorf("%s: keyword arguments are not supported", f.name)
+	}
+	typ := f.v.Type()
+	n := typ.NumIn()
+	if (!typ.IsVariadic() && len(args) != n) || (typ.IsVariadic() && len(args) < n-1) {
+		return nil, fmt.Errorf("%s: %d arguments expected, but got %d", f.name, n, len(args))
+	}
+	in := make([]reflect.Value, 0, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if typ.IsVariadic() && i >= n-1 {
+			t = typ.In(n - 1).Elem()
+		} else {
+			t = typ.In(i)
+		}
+		v, err := f.r.toReflect(arg, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument #%d: %w", f.name, i+1, err)
+		}
+		in = append(in, v)
+	}
+	out := f.v.Call(in)
+	switch len(out) {
+	case 0:
+		return starlark.None, nil
+	case 1:
+		return f.r.fromGo(out[0].Interface()), nil
+	}
+	ret := make(starlark.Tuple, 0, len(out))
+	for _, v := range out {
+		ret = append(ret, f.r.fromGo(v.Interface()))
+	}
+	return ret, nil
+}
+
+// starlarkFunc is a Starlark function as a scriptFunc.
+// Functions return multiple values as a tuple.
+type starlarkFunc struct {
+	r  *starlarkRuntime
+	fn starlark.Callable
+}
+
+func (f *starlarkFunc) call(nret int, args ...any) ([]any, error) {
+	sargs := make(starlark.Tuple, 0, len(args))
+	for _, arg := range args {
+		sargs = append(sargs, f.r.fromGo(arg))
+	}
+	v, err := starlark.Call(f.r.thread, f.fn, sargs, nil)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]any, nret)
+	values := []starlark.Value{v}
+	if tuple, ok := v.(starlark.Tuple); ok && nret > 1 {
+		values = tuple
+	}
+	for i := 0; i < nret && i < len(values); i++ {
+		ret[i] = f.r.result(values[i])
+	}
+	return ret, nil
+}
+
+// result converts a value returned from Starlark functions into a Go value.
+// Dicts are converted into nodeProps.
+func (r *starlarkRuntime) result(v starlark.Value) any {
+	if d, ok := v.(*starlark.Dict); ok {
+		return &starlarkProps{r: r, dict: d}
+	}
+	return r.toGo(v)
+}
+
+// starlarkProps is a Starlark dict as nodeProps.
+type starlarkProps struct {
+	r    *starlarkRuntime
+	dict *starlark.Dict
+}
+
+func (p *starlarkProps) get(name string) any {
+	v, found, _ := p.dict.Get(starlark.String(name))
+	if !found {
+		return starlark.None
+	}
+	return v
+}
+
+func (p *starlarkProps) toMap() map[string]any {
+	m, _ := p.r.toGo(p.dict).(map[string]any)
+	return m
+}
+
+// starlarkObject is a Starlark dict as a scriptObject.
+type starlarkObject struct {
+	r       *starlarkRuntime
+	name    string
+	dict    *starlark.Dict
+	onError func(error)
+}
+
+func (o *starlarkObject) typeError(key, typ string) {
+	o.onError(fmt.Errorf("%s.%s: must be a %s", o.name, key, typ))
+}
+
+func (o *starlarkObject) get(key string) starlark.Value {
+	v, found, _ := o.dict.Get(starlark.String(key))
+	if !found || v == starlark.None {
+		return nil
+	}
+	return v
+}
+
+func (o *starlarkObject) Func(key string, required bool) scriptFunc {
+	v := o.get(key)
+	if v == nil {
+		if required {
+			o.typeError(key, "function")
+		}
+		return nil
+	}
+	fn, ok := v.(starlark.Callable)
+	if !ok {
+		o.typeError(key, "function")
+		return nil
+	}
+	return &starlarkFunc{r: o.r, fn: fn}
+}
+
+func (o *starlarkObject) Bytes(key string) []byte {
+	switch v := o.get(key).(type) {
+	case nil:
+		return nil
+	case starlark.String:
+		return []byte(v)
+	case starlark.Bytes:
+		return []byte(v)
+	}
+	o.typeError(key, "string")
+	return nil
+}
+
+func (o *starlarkObject) Bool(key string) bool {
+	v := o.get(key)
+	return v != nil && bool(v.Truth())
+}
+
+func (o *starlarkObject) Int(key string) int {
+	v := o.get(key)
+	if v == nil {
+		return 0
+	}
+	i, ok := toInt(o.r.toGo(v))
+	if !ok {
+		o.typeError(key, "number")
+	}
+	return i
+}
+
+func (o *starlarkObject) Value(key string) any {
+	v := o.get(key)
+	if v == nil {
+		return nil
+	}
+	return o.r.result(v)
+}
+
+func (o *starlarkObject) Props(key string) nodeProps {
+	switch v := o.get(key).(type) {
+	case nil:
+		return mapProps{}
+	case *starlark.Dict:
+		return &starlarkProps{r: o.r, dict: v}
+	}
+	o.typeError(key, "dict")
+	return mapProps{}
+}
@@ -0,0 +1,318 @@
+package dynamic
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// syntaxRule is a common part of declarative syntax rules like
+// gparser.inlinePattern and gparser.fencedBlock.
+type syntaxRule struct {
+	onError func(error)
+
+	name     string
+	trigger  []byte
+	kind     ast.NodeKind
+	defaults map[string]any
+	fprops   scriptFunc
+	enter    string
+	exit     string
+}
+
+func newSyntaxRule(name string, obj scriptObject, onError func(error)) *syntaxRule {
+	r := &syntaxRule{
+		onError: onError,
+
+		name:     name,
+		trigger:  obj.Bytes("triggers"),
+		defaults: obj.Props("defaults").toMap(),
+		fprops:   obj.Func("props", false),
+	}
+	if len(r.trigger) == 0 {
+		onError(fmt.Errorf("can not define %s without triggers", name))
+	}
+
+	switch v := obj.Value("kind").(type) {
+	case string:
+		if len(v) == 0 {
+			onError(fmt.Errorf("can not define %s without kind", name))
+		}
+		r.kind = ast.NewNodeKind(v)
+	case nil:
+		onError(fmt.Errorf("can not define %s without kind", name))
+	default:
+		if kind, ok := toInt(v); ok {
+			r.kind = ast.NodeKind(kind)
+		} else {
+			onError(fmt.Errorf("%s.kind: must be an ast.NodeKind", name))
+		}
+	}
+
+	switch v := obj.Value("html").(type) {
+	case nil:
+	case string:
+		r.enter = v
+	default:
+		html := obj.Props("html")
+		r.enter = fmt.Sprint(valueOr(html.toMap()["enter"], ""))
+		r.exit = fmt.Sprint(valueOr(html.toMap()["exit"], ""))
+	}
+	return r
+}
+
+func valueOr(v, def any) any {
+	if v == nil {
+		return def
+	}
+	return v
+}
+
+func compileSyntaxPattern(name string, obj scriptObject, key string, onError func(error)) *regexp.Regexp {
+	source := obj.Bytes(key)
+	if source == nil {
+		return nil
+	}
+	return compileAnchoredPattern(name, key, string(source), onError)
+}
+
+func compileAnchoredPattern(name, key, source string, onError func(error)) *regexp.Regexp {
+	// patterns always match at the current position of the reader.
+	re, err := regexp.Compile("^(?:" + source + ")")
+	if err != nil {
+		onError(fmt.Errorf("%s.%s: %w", name, key, err))
+		return nil
+	}
+	return re
+}
+
+// newProps creates props of a node from the submatches.
+// Captures are accessible by indices and names of groups, index 0 is a whole
+// match. Empty captures are replaced with defaults. If a props function is
+// defined, props are the return value of the function.
+func (r *syntaxRule) newProps(re *regexp.Regexp, line []byte, loc []int) nodeProps {
+	captures := make(map[any]any, len(loc))
+	for i, name := range re.SubexpNames() {
+		value := ""
+		if loc[i*2] >= 0 {
+			value = string(line[loc[i*2]:loc[i*2+1]])
+		}
+		captures[i] = value
+		if len(name) != 0 {
+			captures[name] = value
+		}
+	}
+	for key, value := range r.defaults {
+		if v, ok := captures[key]; !ok || v == "" {
+			captures[key] = value
+		}
+	}
+	if r.fprops == nil {
+		return mapProps(stringKeys(captures))
+	}
+	ret, err := r.fprops.call(1, captures)
+	if err != nil {
+		r.onError(err)
+		return mapProps(stringKeys(captures))
+	}
+	switch v := ret[0].(type) {
+	case nodeProps:
+		return v
+	case map[string]any:
+		return mapProps(v)
+	}
+	r.onError(fmt.Errorf("%s.props returns an invalid value: must be a table", r.name))
+	return mapProps(stringKeys(captures))
+}
+
+// NewRenderer returns a new HTML renderer that renders nodes created by
+// this rule with html templates.
+func (r *syntaxRule) NewRenderer() renderer.NodeRenderer {
+	return &syntaxHTMLRenderer{rule: r}
+}
+
+type syntaxHTMLRenderer struct {
+	rule *syntaxRule
+}
+
+func (r *syntaxHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(r.rule.kind, r.render)
+}
+
+func (r *syntaxHTMLRenderer) render(w util.BufWriter, source []byte, n ast.Node,
+	entering bool) (ast.WalkStatus, error) {
+	node, ok := n.(propsNode)
+	if !ok {
+		return ast.WalkContinue, nil
+	}
+	if !entering {
+		_, _ = w.WriteString(expandTemplate(r.rule.exit, node))
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(expandTemplate(r.rule.enter, node))
+	if n.Type() == ast.TypeBlock && n.IsRaw() {
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+		}
+	}
+	return ast.WalkContinue, nil
+}
+
+// expandTemplate replaces ${name} or $name in the template with HTML escaped
+// props of the node.
+func expandTemplate(template string, node propsNode) string {
+	if len(template) == 0 {
+		return template
+	}
+	props := node.Props()
+	return os.Expand(template, func(key string) string {
+		v, ok := props[key]
+		if !ok || v == nil {
+			return ""
+		}
+		if bs, ok := v.([]byte); ok {
+			return string(util.EscapeHTML(bs))
+		}
+		return string(util.EscapeHTML([]byte(fmt.Sprint(v))))
+	})
+}
+
+var _ parser.InlineParser = (*patternInlineParser)(nil)
+
+type patternInlineParser struct {
+	*syntaxRule
+
+	pattern *regexp.Regexp
+}
+
+func newPatternInlineParser(obj scriptObject, onError func(error)) *patternInlineParser {
+	return &patternInlineParser{
+		syntaxRule: newSyntaxRule("InlinePattern", obj, onError),
+		pattern:    compileSyntaxPattern("InlinePattern", obj, "pattern", onError),
+	}
+}
+
+func (s *patternInlineParser) Trigger() []byte {
+	return s.trigger
+}
+
+func (s *patternInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if s.pattern == nil {
+		return nil
+	}
+	line, segment := block.PeekLine()
+	loc := s.pattern.FindSubmatchIndex(line)
+	// an empty match does not advance the block, goldmark would trigger
+	// this parser at the same position forever.
+	if loc == nil || loc[1] == 0 {
+		return nil
+	}
+	node := &dynamicInlineNode{
+		dynamicNode: dynamicNode{
+			onError: s.onError,
+
+			kind: s.kind,
+			p:    s.newProps(s.pattern, line, loc),
+		},
+	}
+	block.Advance(loc[1])
+	recordPosition(node, segment.Start, block, pc)
+	return node
+}
+
+var _ parser.BlockParser = (*fencedBlockParser)(nil)
+
+type fencedBlockParser struct {
+	*syntaxRule
+
+	open                  *regexp.Regexp
+	close                 *regexp.Regexp
+	raw                   bool
+	canInterruptParagraph bool
+}
+
+func newFencedBlockParser(obj scriptObject, onError func(error)) *fencedBlockParser {
+	canInterruptParagraph := true
+	if v := obj.Value("canInterruptParagraph"); v != nil {
+		canInterruptParagraph = obj.Bool("canInterruptParagraph")
+	}
+	return &fencedBlockParser{
+		syntaxRule: newSyntaxRule("FencedBlock", obj, onError),
+
+		open:                  compileSyntaxPattern("FencedBlock", obj, "open", onError),
+		close:                 compileSyntaxPattern("FencedBlock", obj, "close", onError),
+		raw:                   obj.Bool("raw"),
+		canInterruptParagraph: canInterruptParagraph,
+	}
+}
+
+func (s *fencedBlockParser) Trigger() []byte {
+	return s.trigger
+}
+
+func (s *fencedBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if s.open == nil || s.close == nil {
+		return nil, parser.NoChildren
+	}
+	line, segment := reader.PeekLine()
+	loc := s.open.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil, parser.NoChildren
+	}
+	node := &dynamicBlockNode{
+		dynamicNode: dynamicNode{
+			onError: s.onError,
+
+			kind: s.kind,
+			raw:  s.raw,
+			p:    s.newProps(s.open, line, loc),
+		},
+	}
+	reader.Advance(segment.Len() - newlineLength(line))
+	recordPosition(node, segment.Start, reader, pc)
+	if s.raw {
+		return node, parser.NoChildren
+	}
+	return node, parser.HasChildren
+}
+
+func (s *fencedBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if s.close.Match(line) {
+		reader.Advance(segment.Len() - newlineLength(line) + segment.Padding)
+		extendPosition(node, reader, pc)
+		return parser.Close
+	}
+	if s.raw {
+		node.Lines().Append(segment)
+		reader.AdvanceAndSetPadding(segment.Len()-newlineLength(line), segment.Padding)
+		extendPosition(node, reader, pc)
+		return parser.Continue | parser.NoChildren
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (s *fencedBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+}
+
+func (s *fencedBlockParser) CanInterruptParagraph() bool {
+	return s.canInterruptParagraph
+}
+
+func (s *fencedBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// newlineLength returns a length of a trailing newline("\n" or "\r\n") of
+// the line. The last line of a source may not have a newline.
+func newlineLength(line []byte) int {
+	return util.TrimRightLength(line, []byte("\r\n"))
+}
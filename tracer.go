@@ -0,0 +1,86 @@
+package dynamic
+
+import (
+	"context"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// Span names started by goldmark-dynamic.
+const (
+	SpanLoad                    = "goldmark-dynamic.Load"
+	SpanASTTransformerTransform = "goldmark-dynamic.ASTTransformer.Transform"
+	SpanNodeRendererRegister    = "goldmark-dynamic.NodeRenderer.Register"
+)
+
+// Span attribute keys set by goldmark-dynamic.
+const (
+	AttributeExtensionFile = "goldmark_dynamic.extension.file"
+	AttributeExtensionName = "goldmark_dynamic.extension.name"
+	AttributeNodeKind      = "goldmark_dynamic.node.kind"
+)
+
+// SpanAttribute is a key-value attribute of a span.
+type SpanAttribute struct {
+	Key   string
+	Value string
+}
+
+// Span is a span started by a [Tracer].
+type Span interface {
+	// RecordError records an error occurred in the span.
+	RecordError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// Tracer starts spans for loading extensions, AST transformers and
+// registrations of node renderers of extensions. Spans are not started per
+// node rendering and per parser call because documents have too many of them.
+// Use [Metrics] to measure them.
+// Tracer is small enough to be adapted to OpenTelemetry or other tracers
+// without adding dependencies to goldmark-dynamic.
+type Tracer interface {
+	// Start starts a span that is a child of a span in the ctx.
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+}
+
+// WithTracer is an option that sets a [Tracer].
+func WithTracer(t Tracer) Option {
+	return func(e *dynamic) {
+		e.tracer = t
+	}
+}
+
+var traceContextKey = parser.NewContextKey()
+
+// WithTraceContext sets a context that has a parent span of spans started
+// while converting documents with the pc, and returns the pc.
+func WithTraceContext(pc parser.Context, ctx context.Context) parser.Context {
+	pc.Set(traceContextKey, ctx)
+	return pc
+}
+
+func traceContext(pc parser.Context) context.Context {
+	if pc != nil {
+		if ctx, ok := pc.Get(traceContextKey).(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// startSpan starts a span with attributes of the extension. startSpan
+// returns the ctx and nil if the tracer is not set.
+func (s *extensionScope) startSpan(ctx context.Context, name string,
+	attrs ...SpanAttribute) (context.Context, Span) {
+	if s.tracer == nil {
+		return ctx, nil
+	}
+	attrs = append([]SpanAttribute{
+		{Key: AttributeExtensionFile, Value: s.file},
+		{Key: AttributeExtensionName, Value: s.name},
+	}, attrs...)
+	return s.tracer.Start(ctx, name, attrs...)
+}
@@ -0,0 +1,89 @@
+package dynamic
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var documentVarsKey = parser.NewContextKey()
+
+// internalAttributePrefix is a prefix of attributes that are used by
+// goldmark-dynamic internally.
+const internalAttributePrefix = "goldmark-dynamic:"
+
+func isInternalAttribute(name []byte) bool {
+	return bytes.HasPrefix(name, []byte(internalAttributePrefix))
+}
+
+// documentVarsAttribute is a name of an attribute of ast.Document that holds
+// document variables while rendering.
+var documentVarsAttribute = []byte(internalAttributePrefix + "vars")
+
+// WithDocumentVars attaches per-document variables(e.g. a current user, a
+// base URL and a locale) to the pc and returns the pc.
+// Variables are readable in hooks of extensions by vars(pc) or vars(node) of
+// the goldmark.dynamic module.
+//
+//	pc := dynamic.WithDocumentVars(parser.NewContext(), map[string]any{
+//	    "user": "yuin",
+//	})
+//	markdown.Convert(source, &buf, parser.WithContext(pc))
+func WithDocumentVars(pc parser.Context, vars map[string]any) parser.Context {
+	pc.Set(documentVarsKey, vars)
+	return pc
+}
+
+// DocumentVars returns variables attached by [WithDocumentVars].
+// v is a parser.Context or an ast.Node in a document that is parsed with
+// the parser.Context. DocumentVars returns an empty map if no variables are
+// attached.
+func DocumentVars(v any) map[string]any {
+	var vars any
+	switch c := v.(type) {
+	case parser.Context:
+		vars = c.Get(documentVarsKey)
+	case ast.Node:
+		if doc := c.OwnerDocument(); doc != nil {
+			vars, _ = doc.AttributeString(string(documentVarsAttribute))
+		}
+	}
+	if m, ok := vars.(map[string]any); ok {
+		return m
+	}
+	return map[string]any{}
+}
+
+// documentVarsTransformer copies document variables to the document, so
+// renderers can read them.
+type documentVarsTransformer struct {
+}
+
+func (t *documentVarsTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	if vars := pc.Get(documentVarsKey); vars != nil {
+		node.SetAttribute(documentVarsAttribute, vars)
+	}
+}
+
+// documentVarsPriority makes documentVarsTransformer run before all
+// transformers. Transformers that have lower priority values run earlier.
+const documentVarsPriority = math.MinInt32
+
+func goldmarkDynamicMembers() []moduleMember {
+	return []moduleMember{
+		{
+			name:  "vars",
+			value: DocumentVars,
+		},
+	}
+}
+
+func luaDocumentVars(l *lua.LState) int {
+	ud := l.CheckUserData(1)
+	l.Push(goToLua(l, DocumentVars(ud.Value)))
+	return 1
+}
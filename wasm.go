@@ -0,0 +1,490 @@
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// WasmRuntime is a RuntimeFactory for WebAssembly modules(.wasm).
+//
+// Modules communicate with goldmark-dynamic through the ABI described below.
+// All values are exchanged as JSON written to the linear memory of modules.
+//
+// Modules must export:
+//
+//   - memory: the linear memory.
+//   - gd_alloc(size i32) i32: allocates size bytes and returns a pointer.
+//     goldmark-dynamic writes inputs to allocated memory.
+//   - gd_manifest() i64: returns a manifest.
+//
+// Modules may export:
+//
+//   - gd_free(ptr i32, size i32): releases memory allocated by gd_alloc or
+//     results. This is called after goldmark-dynamic reads results.
+//   - gd_init(ptr i32, size i32): receives Extension.Options. This is called
+//     before gd_manifest.
+//   - gd_inline_parse, gd_block_open, gd_block_continue, gd_block_close,
+//     gd_transform and gd_render(id i32, ptr i32, size i32) i64: hooks
+//     declared in the manifest. id is an id declared in the manifest.
+//
+// Functions that return i64 return a pointer to a result in the upper 32 bits
+// and a size of the result in the lower 32 bits. 0 means no results.
+// See README for details of inputs and results.
+var WasmRuntime = NewRuntimeFactory([]string{".wasm"}, func(config *RuntimeConfig) Runtime {
+	return newWasmRuntime(config)
+})
+
+type wasmRuntime struct {
+	config  *RuntimeConfig
+	ctx     context.Context
+	runtime wazero.Runtime
+	kinds   map[string]ast.NodeKind
+}
+
+func newWasmRuntime(config *RuntimeConfig) *wasmRuntime {
+	ctx := context.Background()
+	r := &wasmRuntime{
+		config:  config,
+		ctx:     ctx,
+		runtime: wazero.NewRuntime(ctx),
+		kinds:   map[string]ast.NodeKind{},
+	}
+	wasi_snapshot_preview1.MustInstantiate(ctx, r.runtime)
+	for _, member := range goldmarkASTMembers() {
+		if kind, ok := member.value.(ast.NodeKind); ok {
+			r.kinds[kind.String()] = kind
+		}
+	}
+	return r
+}
+
+// kind returns a NodeKind that has the given name. Modules share node kinds
+// by names.
+func (r *wasmRuntime) kind(name string) ast.NodeKind {
+	if kind, ok := r.kinds[name]; ok {
+		return kind
+	}
+	kind := ast.NewNodeKind(name)
+	r.kinds[name] = kind
+	return kind
+}
+
+type wasmManifest struct {
+	InlineParsers []struct {
+		ID       int    `json:"id"`
+		Triggers string `json:"triggers"`
+		Priority int    `json:"priority"`
+	} `json:"inlineParsers"`
+	BlockParsers []struct {
+		ID                    int    `json:"id"`
+		Triggers              string `json:"triggers"`
+		Priority              int    `json:"priority"`
+		CanInterruptParagraph bool   `json:"canInterruptParagraph"`
+		CanAcceptIndentedLine bool   `json:"canAcceptIndentedLine"`
+	} `json:"blockParsers"`
+	ASTTransformers []struct {
+		ID       int `json:"id"`
+		Priority int `json:"priority"`
+	} `json:"astTransformers"`
+	Renderers []struct {
+		ID       int      `json:"id"`
+		Kinds    []string `json:"kinds"`
+		Priority int      `json:"priority"`
+	} `json:"renderers"`
+}
+
+func (r *wasmRuntime) Load(m goldmark.Markdown, extension Extension) (map[string]Function, error) {
+	return nil, r.load(m, extension)
+}
+
+func (r *wasmRuntime) load(m goldmark.Markdown, extension Extension) error {
+	bin, err := fs.ReadFile(r.config.FS, extension.File)
+	if err != nil {
+		return err
+	}
+	// modules are anonymous, so the same file can be instantiated multiple
+	// times.
+	mod, err := r.runtime.InstantiateWithConfig(r.ctx, bin,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", extension.File, err)
+	}
+	w := &wasmModule{
+		runtime: r,
+		name:    extension.File,
+		mod:     mod,
+		onError: r.config.OnError,
+	}
+	if w.mod.ExportedFunction("gd_alloc") == nil || w.mod.ExportedFunction("gd_manifest") == nil {
+		return fmt.Errorf("%s: gd_alloc and gd_manifest must be exported", extension.File)
+	}
+	if w.mod.ExportedFunction("gd_init") != nil {
+		options, err := json.Marshal(extension.Options)
+		if err != nil {
+			return err
+		}
+		ptr, size, err := w.write(options)
+		if err != nil {
+			return err
+		}
+		_, err = w.mod.ExportedFunction("gd_init").Call(r.ctx, ptr, size)
+		w.free(ptr, size)
+		if err != nil {
+			return fmt.Errorf("%s: %w", extension.File, err)
+		}
+	}
+	ret, err := w.mod.ExportedFunction("gd_manifest").Call(r.ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", extension.File, err)
+	}
+	var manifest wasmManifest
+	if err := w.result(ret[0], &manifest); err != nil {
+		return fmt.Errorf("%s: gd_manifest returns an invalid value: %w", extension.File, err)
+	}
+
+	for _, p := range manifest.InlineParsers {
+		m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(&wasmInlineParser{
+			module:  w,
+			id:      uint64(p.ID),
+			trigger: []byte(p.Triggers),
+		}, priorityOf(p.Priority))))
+	}
+	for _, p := range manifest.BlockParsers {
+		m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(&wasmBlockParser{
+			module:                w,
+			id:                    uint64(p.ID),
+			trigger:               []byte(p.Triggers),
+			canInterruptParagraph: p.CanInterruptParagraph,
+			canAcceptIndentedLine: p.CanAcceptIndentedLine,
+		}, priorityOf(p.Priority))))
+	}
+	for _, t := range manifest.ASTTransformers {
+		m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&wasmASTTransformer{
+			module: w,
+			id:     uint64(t.ID),
+		}, priorityOf(t.Priority))))
+	}
+	for _, v := range manifest.Renderers {
+		kinds := make([]ast.NodeKind, 0, len(v.Kinds))
+		for _, name := range v.Kinds {
+			kinds = append(kinds, r.kind(name))
+		}
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&wasmRenderer{
+			module: w,
+			id:     uint64(v.ID),
+			kinds:  kinds,
+		}, priorityOf(v.Priority))))
+	}
+	return nil
+}
+
+func (r *wasmRuntime) Close() {
+	_ = r.runtime.Close(r.ctx)
+}
+
+// wasmModule is an instantiated WebAssembly module.
+type wasmModule struct {
+	runtime *wasmRuntime
+	name    string
+	mod     api.Module
+	onError func(error)
+}
+
+// write writes the data to memory allocated by gd_alloc.
+func (w *wasmModule) write(data []byte) (uint64, uint64, error) {
+	ret, err := w.mod.ExportedFunction("gd_alloc").Call(w.runtime.ctx, uint64(len(data)))
+	if err != nil {
+		return 0, 0, err
+	}
+	ptr := uint32(ret[0])
+	if !w.mod.Memory().Write(ptr, data) {
+		return 0, 0, fmt.Errorf("gd_alloc returns an out of range pointer")
+	}
+	return uint64(ptr), uint64(len(data)), nil
+}
+
+// read reads a result returned by a function and releases it.
+func (w *wasmModule) read(ret uint64) ([]byte, error) {
+	if ret == 0 {
+		return nil, nil
+	}
+	ptr, size := uint32(ret>>32), uint32(ret)
+	view, ok := w.mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("out of range result")
+	}
+	data := append([]byte{}, view...)
+	w.free(uint64(ptr), uint64(size))
+	return data, nil
+}
+
+// free releases memory by gd_free if it is exported.
+func (w *wasmModule) free(ptr, size uint64) {
+	if free := w.mod.ExportedFunction("gd_free"); free != nil {
+		if _, err := free.Call(w.runtime.ctx, ptr, size); err != nil {
+			w.onError(fmt.Errorf("%s: gd_free: %w", w.name, err))
+		}
+	}
+}
+
+func (w *wasmModule) result(ret uint64, v any) error {
+	data, err := w.read(ret)
+	if err != nil || data == nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// call calls the given hook with the input encoded as JSON and decodes the
+// result into v. call returns false if the hook returns no results.
+func (w *wasmModule) call(name string, id uint64, input any, v any) bool {
+	fn := w.mod.ExportedFunction(name)
+	if fn == nil {
+		w.onError(fmt.Errorf("%s: %s is not exported", w.name, name))
+		return false
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		w.onError(err)
+		return false
+	}
+	ptr, size, err := w.write(data)
+	if err != nil {
+		w.onError(fmt.Errorf("%s: %w", w.name, err))
+		return false
+	}
+	ret, err := fn.Call(w.runtime.ctx, id, ptr, size)
+	w.free(ptr, size)
+	if err != nil {
+		w.onError(fmt.Errorf("%s: %s: %w", w.name, name, err))
+		return false
+	}
+	if ret[0] == 0 {
+		return false
+	}
+	if raw, ok := v.(*[]byte); ok {
+		*raw, err = w.read(ret[0])
+	} else {
+		err = w.result(ret[0], v)
+	}
+	if err != nil {
+		w.onError(fmt.Errorf("%s: %s returns an invalid value: %w", w.name, name, err))
+		return false
+	}
+	return true
+}
+
+type wasmNodeResult struct {
+	Kind     string         `json:"kind"`
+	Props    map[string]any `json:"props"`
+	Consume  int            `json:"consume"`
+	Children bool           `json:"children"`
+	Close    bool           `json:"close"`
+}
+
+func (w *wasmModule) newProps(props map[string]any) nodeProps {
+	if props == nil {
+		return mapProps{}
+	}
+	return mapProps(props)
+}
+
+var _ parser.InlineParser = (*wasmInlineParser)(nil)
+
+type wasmInlineParser struct {
+	module  *wasmModule
+	id      uint64
+	trigger []byte
+}
+
+func (s *wasmInlineParser) Trigger() []byte {
+	return s.trigger
+}
+
+func (s *wasmInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	var ret wasmNodeResult
+	if !s.module.call("gd_inline_parse", s.id, map[string]any{
+		"line": string(line),
+	}, &ret) {
+		return nil
+	}
+	node := &dynamicInlineNode{
+		dynamicNode: dynamicNode{
+			onError: s.module.onError,
+
+			kind: s.module.runtime.kind(ret.Kind),
+			p:    s.module.newProps(ret.Props),
+		},
+	}
+	block.Advance(ret.Consume)
+	recordPosition(node, segment.Start, block, pc)
+	return node
+}
+
+var _ parser.BlockParser = (*wasmBlockParser)(nil)
+
+type wasmBlockParser struct {
+	module                *wasmModule
+	id                    uint64
+	trigger               []byte
+	canInterruptParagraph bool
+	canAcceptIndentedLine bool
+}
+
+func (s *wasmBlockParser) Trigger() []byte {
+	return s.trigger
+}
+
+func (s *wasmBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	var ret wasmNodeResult
+	if !s.module.call("gd_block_open", s.id, map[string]any{
+		"line": string(line),
+	}, &ret) {
+		return nil, parser.NoChildren
+	}
+	node := &dynamicBlockNode{
+		dynamicNode: dynamicNode{
+			onError: s.module.onError,
+
+			kind: s.module.runtime.kind(ret.Kind),
+			raw:  !ret.Children,
+			p:    s.module.newProps(ret.Props),
+		},
+	}
+	reader.Advance(ret.Consume)
+	recordPosition(node, segment.Start, reader, pc)
+	if ret.Children {
+		return node, parser.HasChildren
+	}
+	return node, parser.NoChildren
+}
+
+func (s *wasmBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	var ret wasmNodeResult
+	if !s.module.call("gd_block_continue", s.id, map[string]any{
+		"line":  string(line),
+		"props": node.(propsNode).Props(),
+	}, &ret) {
+		return parser.Close
+	}
+	if ret.Props != nil {
+		node.(*dynamicBlockNode).p = mapProps(ret.Props)
+	}
+	if ret.Close {
+		reader.Advance(ret.Consume)
+		extendPosition(node, reader, pc)
+		return parser.Close
+	}
+	if !ret.Children {
+		node.Lines().Append(segment)
+		reader.AdvanceAndSetPadding(segment.Len()-newlineLength(line), segment.Padding)
+		extendPosition(node, reader, pc)
+		return parser.Continue | parser.NoChildren
+	}
+	reader.Advance(ret.Consume)
+	return parser.Continue | parser.HasChildren
+}
+
+func (s *wasmBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	if s.module.mod.ExportedFunction("gd_block_close") == nil {
+		return
+	}
+	var ret wasmNodeResult
+	if s.module.call("gd_block_close", s.id, map[string]any{
+		"props": node.(propsNode).Props(),
+	}, &ret) && ret.Props != nil {
+		node.(*dynamicBlockNode).p = mapProps(ret.Props)
+	}
+}
+
+func (s *wasmBlockParser) CanInterruptParagraph() bool {
+	return s.canInterruptParagraph
+}
+
+func (s *wasmBlockParser) CanAcceptIndentedLine() bool {
+	return s.canAcceptIndentedLine
+}
+
+var _ parser.ASTTransformer = (*wasmASTTransformer)(nil)
+
+type wasmASTTransformer struct {
+	module *wasmModule
+	id     uint64
+}
+
+type wasmTransformResult struct {
+	Attributes []struct {
+		Path  []int  `json:"path"`
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"attributes"`
+}
+
+func (s *wasmASTTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var ret wasmTransformResult
+	if !s.module.call("gd_transform", s.id, map[string]any{
+		"document": NodeToMap(node, source),
+	}, &ret) {
+		return
+	}
+	for _, attr := range ret.Attributes {
+		var n ast.Node = node
+		for _, index := range attr.Path {
+			c := n.FirstChild()
+			for i := 0; c != nil && i < index; i++ {
+				c = c.NextSibling()
+			}
+			n = c
+			if n == nil {
+				break
+			}
+		}
+		if n == nil {
+			s.module.onError(fmt.Errorf("%s: gd_transform returns an invalid path: %v", s.module.name, attr.Path))
+			continue
+		}
+		n.SetAttributeString(attr.Name, []byte(attr.Value))
+	}
+}
+
+var _ renderer.NodeRenderer = (*wasmRenderer)(nil)
+
+type wasmRenderer struct {
+	module *wasmModule
+	id     uint64
+	kinds  []ast.NodeKind
+}
+
+func (r *wasmRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	for _, kind := range r.kinds {
+		reg.Register(kind, r.render)
+	}
+}
+
+func (r *wasmRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	var html []byte
+	if r.module.call("gd_render", r.id, map[string]any{
+		"kind":     n.Kind().String(),
+		"props":    nodePropsToMap(n, source),
+		"entering": entering,
+	}, &html) {
+		_, _ = w.Write(html)
+	}
+	return ast.WalkContinue, nil
+}